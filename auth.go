@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Authenticator 抽象不同校园网 portal 系统的认证方式，ctx 取消时各方法中止正在进行的请求
+type Authenticator interface {
+	// Login 使用配置中的账号登录
+	Login(ctx context.Context) (*loginResult, error)
+	// Logout 注销配置中的账号
+	Logout(ctx context.Context) (*loginResult, error)
+	// Status 查询 portal 记录的当前在线状态
+	Status(ctx context.Context) (*portalStatus, error)
+}
+
+// DefaultPortalType 默认使用的 portal 驱动
+const DefaultPortalType = "eportal"
+
+// authenticators 按 portal_type 注册的驱动构造函数
+var authenticators = map[string]func(config loginConfig) Authenticator{
+	"eportal": newEPortalAuthenticator,
+	"srun":    newSrunAuthenticator,
+	"ruijie":  newRuijieAuthenticator,
+}
+
+// newAuthenticator 根据 login 配置的 portal_type 创建对应的驱动
+func newAuthenticator(config loginConfig) (Authenticator, error) {
+	portalType := config.PortalType
+	if portalType == "" {
+		portalType = DefaultPortalType
+	}
+	factory, ok := authenticators[portalType]
+	if !ok {
+		return nil, fmt.Errorf("不支持的 portal_type: %s", portalType)
+	}
+	return factory(config), nil
+}
+
+// runAuthAction 根据 action 调用驱动的登录或注销
+func runAuthAction(ctx context.Context, auth Authenticator, action string) (*loginResult, error) {
+	if action == "logout" {
+		return auth.Logout(ctx)
+	}
+	return auth.Login(ctx)
+}
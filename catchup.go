@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cumtnet/scheduler"
+)
+
+// catchUpJob 在启动和重新加载配置后执行一次，把每个目标恢复到最近一次应执行的规则的状态，
+// 不会重放所有错过的执行
+type catchUpJob struct {
+	logins   []loginConfig
+	passwall *passwallConfig
+	done     bool
+}
+
+// planCatchUp 按目标找出最近一次应执行的规则：
+// login 按出口（source_ip 或 interface）区分，passwall 只有一个目标
+func planCatchUp(now time.Time, loginConfigs []loginConfig, passwallConfigs []passwallConfig) *catchUpJob {
+	job := &catchUpJob{}
+
+	// 按出口收集定时规则，出口的顺序与配置中第一次出现的顺序一致
+	var uplinks []string
+	uplinkRules := make(map[string][]uplinkRule)
+	logins := make(map[string]loginConfig)
+	for _, config := range loginConfigs {
+		schedule, ok := catchUpSchedule(config.Enabled, config.Config)
+		if !ok {
+			continue
+		}
+		target := config.uplink()
+		if _, seen := uplinkRules[target]; !seen {
+			uplinks = append(uplinks, target)
+		}
+		uplinkRules[target] = append(uplinkRules[target], uplinkRule{ID: config.ID, Action: config.Action, Schedule: schedule})
+		logins[config.ID] = config
+	}
+	for _, target := range uplinks {
+		rule := latestUplinkRule(now, uplinkRules[target])
+		if rule == nil {
+			continue
+		}
+		prev, _ := rule.Schedule.Prev(now)
+		log.Printf("[%s] 补执行：最近一次 %s 应于 %s 执行\n", rule.ID, rule.Action, prev.Format(statusTimeFormat))
+		job.logins = append(job.logins, logins[rule.ID])
+	}
+
+	if passwallTaskEnable {
+		var rules []uplinkRule
+		passwalls := make(map[string]*passwallConfig)
+		for i, config := range passwallConfigs {
+			if config.Action != "enable" && config.Action != "disable" {
+				continue
+			}
+			schedule, ok := catchUpSchedule(config.Enabled, config.Config)
+			if !ok {
+				continue
+			}
+			rules = append(rules, uplinkRule{ID: config.ID, Action: config.Action, Schedule: schedule})
+			passwalls[config.ID] = &passwallConfigs[i]
+		}
+		if rule := latestUplinkRule(now, rules); rule != nil {
+			prev, _ := rule.Schedule.Prev(now)
+			log.Printf("[%s] 补执行：最近一次 Passwall %s 应于 %s 执行\n", rule.ID, rule.Action, prev.Format(statusTimeFormat))
+			job.passwall = passwalls[rule.ID]
+		}
+	}
+	return job
+}
+
+// catchUpSchedule 返回参与补执行的规则的执行计划，未启用或未配置执行时间的规则返回 false
+func catchUpSchedule(enabled bool, config Config) (scheduler.Schedule, bool) {
+	if !enabled || (config.Cron == "" && config.Time == "" && len(config.Weekdays) == 0) {
+		return nil, false
+	}
+	schedule, err := config.schedule()
+	if err != nil {
+		return nil, false
+	}
+	return schedule, true
+}
+
+func (j *catchUpJob) ID() string { return "#catchup" }
+
+// Next 只在启动后立即执行一次
+func (j *catchUpJob) Next(now time.Time) (time.Time, bool) {
+	if j.done || (len(j.logins) == 0 && j.passwall == nil) {
+		return time.Time{}, false
+	}
+	j.done = true
+	return now, true
+}
+
+func (j *catchUpJob) Run(ctx context.Context) {
+	for _, config := range j.logins {
+		if ctx.Err() != nil {
+			return
+		}
+		// runLoginTask 会先查询在线状态，已处于期望状态时跳过
+		log.Printf("[%s] 正在补执行Login任务...\n", config.ID)
+		runLoginTask(ctx, config)
+	}
+	if j.passwall != nil && ctx.Err() == nil {
+		if passwallInState(*j.passwall, uciGet) {
+			log.Printf("[%s] Passwall 已处于期望状态，跳过补执行\n", j.passwall.ID)
+			return
+		}
+		log.Printf("[%s] 正在补执行Passwall任务...\n", j.passwall.ID)
+		execPasswallCommand(ctx, *j.passwall)
+		if ctx.Err() == nil {
+			recordPasswallRun(j.passwall.ID)
+		}
+	}
+}
+
+// passwallInState 判断 passwall 是否已处于规则期望的状态，避免补执行时无谓地重启服务，lookup 读取 uci 配置项
+func passwallInState(config passwallConfig, lookup func(key string) (string, error)) bool {
+	enabled, err := lookup("passwall.@global[0].enabled")
+	if err != nil {
+		return false
+	}
+	if config.Action == "disable" {
+		return enabled == "0"
+	}
+	if enabled != "1" {
+		return false
+	}
+	node, err := lookup("passwall.@global[0].tcp_node")
+	if err != nil || node != config.Node {
+		return false
+	}
+	// updatePasswallConfig 中 rule 配置集使用 chinadns-ng，global 使用 dnsmasq
+	shunt, err := lookup("passwall.@global[0].dns_shunt")
+	if err != nil {
+		return false
+	}
+	if config.Mode == "rule" {
+		return shunt == "chinadns-ng"
+	}
+	return shunt == "dnsmasq"
+}
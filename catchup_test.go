@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// catchUpIDs 返回补执行计划中 login 规则的 ID
+func catchUpIDs(job *catchUpJob) string {
+	var ids []string
+	for _, config := range job.logins {
+		ids = append(ids, config.ID)
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestPlanCatchUpLogins(t *testing.T) {
+	rule := func(id, action, sourceIP string, weekdays []int, at, cron string) loginConfig {
+		return loginConfig{
+			Config:   Config{ID: id, Enabled: true, Weekdays: weekdays, Time: at, Cron: cron},
+			Action:   action,
+			SourceIP: sourceIP,
+		}
+	}
+	weekdays := []int{1, 2, 3, 4, 5}
+	everyday := []int{0, 1, 2, 3, 4, 5, 6}
+	configs := []loginConfig{
+		rule("in", "login", "", weekdays, "08:00:00", ""),
+		rule("out", "logout", "", everyday, "23:00:00", ""),
+		// 第二个出口上的规则与第一个出口交错
+		rule("wan2-in", "login", "10.0.0.2", nil, "", "0 7 * * *"),
+		rule("weekend", "login", "", nil, "", "0 12 * * 6,0"),
+		rule("wan2-out", "logout", "10.0.0.2", nil, "", "30 22 * * *"),
+		// 未启用、只做掉线检测和永远不会执行的规则不参与补执行
+		{Config: Config{ID: "disabled", Weekdays: everyday, Time: "12:30:00"}, Action: "logout"},
+		{Config: Config{ID: "keepalive", Enabled: true}, Action: "login", Keepalive: true},
+		rule("never", "logout", "", nil, "", "0 0 30 2 *"),
+	}
+	// 2026-10-16 为星期五
+	tests := []struct {
+		now  time.Time
+		want string
+	}{
+		// 当天的登录还没到，不提前执行，恢复到前一晚的注销
+		{time.Date(2026, 10, 16, 6, 0, 0, 0, time.UTC), "out wan2-out"},
+		{time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC), "in wan2-in"},
+		{time.Date(2026, 10, 16, 23, 30, 0, 0, time.UTC), "out wan2-out"},
+		// 周六中午的规则晚于周五晚上的注销
+		{time.Date(2026, 10, 17, 11, 0, 0, 0, time.UTC), "out wan2-in"},
+		{time.Date(2026, 10, 17, 13, 0, 0, 0, time.UTC), "weekend wan2-in"},
+		{time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC), "in wan2-in"},
+	}
+	for _, tt := range tests {
+		if got := catchUpIDs(planCatchUp(tt.now, configs, nil)); got != tt.want {
+			t.Errorf("planCatchUp at %s = %q, want %q", tt.now.Format(statusTimeFormat), got, tt.want)
+		}
+	}
+
+	// 同一时间到期的规则以配置中靠后的为准
+	tie := []loginConfig{
+		rule("first", "login", "", everyday, "08:00:00", ""),
+		rule("second", "logout", "", nil, "", "0 8 * * *"),
+	}
+	if got := catchUpIDs(planCatchUp(tests[1].now, tie, nil)); got != "second" {
+		t.Errorf("planCatchUp with rules due at the same time = %q, want second", got)
+	}
+
+	// 没有上一次执行时间的规则不会补执行，计划为空时任务不运行
+	job := planCatchUp(tests[1].now, []loginConfig{configs[7], configs[6]}, nil)
+	if got := catchUpIDs(job); got != "" {
+		t.Errorf("planCatchUp without a previous run = %q, want nothing", got)
+	}
+	if _, ok := job.Next(tests[1].now); ok {
+		t.Error("empty catch-up job was scheduled")
+	}
+}
+
+func TestPlanCatchUpPasswall(t *testing.T) {
+	old := passwallTaskEnable
+	t.Cleanup(func() { passwallTaskEnable = old })
+
+	rule := func(id, action, cron string) passwallConfig {
+		return passwallConfig{Config: Config{ID: id, Enabled: true, Cron: cron}, Action: action, Node: "node1", Mode: "rule"}
+	}
+	configs := []passwallConfig{
+		rule("on", "enable", "0 8 * * 1-5"),
+		rule("off", "disable", "0 23 * * *"),
+		rule("other", "restart", "0 12 * * *"),
+		{Config: Config{ID: "disabled", Cron: "0 13 * * *"}, Action: "disable"},
+		rule("never", "enable", "0 0 30 2 *"),
+	}
+	tests := []struct {
+		now  time.Time
+		want string
+	}{
+		{time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC), "off"},
+		{time.Date(2026, 10, 16, 14, 0, 0, 0, time.UTC), "on"},
+		{time.Date(2026, 10, 17, 14, 0, 0, 0, time.UTC), "off"},
+	}
+	passwallTaskEnable = true
+	for _, tt := range tests {
+		job := planCatchUp(tt.now, nil, configs)
+		got := ""
+		if job.passwall != nil {
+			got = job.passwall.ID
+		}
+		if got != tt.want {
+			t.Errorf("passwall catch-up at %s = %q, want %q", tt.now.Format(statusTimeFormat), got, tt.want)
+		}
+	}
+	if job := planCatchUp(tests[0].now, nil, configs[3:]); job.passwall != nil {
+		t.Errorf("passwall catch-up without a previous run = %s, want none", job.passwall.ID)
+	}
+
+	// passwall 不可用时不补执行
+	passwallTaskEnable = false
+	if job := planCatchUp(tests[1].now, nil, configs); job.passwall != nil {
+		t.Errorf("passwall catch-up without passwall = %s, want none", job.passwall.ID)
+	}
+}
+
+func TestPasswallInState(t *testing.T) {
+	uci := func(values map[string]string) func(key string) (string, error) {
+		return func(key string) (string, error) {
+			if v, ok := values[key]; ok {
+				return v, nil
+			}
+			return "", errors.New("uci: Entry not found")
+		}
+	}
+	enabled := func(node, shunt string) map[string]string {
+		return map[string]string{
+			"passwall.@global[0].enabled":   "1",
+			"passwall.@global[0].tcp_node":  node,
+			"passwall.@global[0].dns_shunt": shunt,
+		}
+	}
+	ruleMode := passwallConfig{Action: "enable", Node: "node1", Mode: "rule"}
+	globalMode := passwallConfig{Action: "enable", Node: "node1", Mode: "global"}
+	disable := passwallConfig{Action: "disable"}
+	tests := []struct {
+		name   string
+		config passwallConfig
+		uci    map[string]string
+		want   bool
+	}{
+		{"rule mode matches", ruleMode, enabled("node1", "chinadns-ng"), true},
+		{"global mode matches", globalMode, enabled("node1", "dnsmasq"), true},
+		{"different mode", globalMode, enabled("node1", "chinadns-ng"), false},
+		{"different node", ruleMode, enabled("node2", "chinadns-ng"), false},
+		{"passwall disabled", ruleMode, map[string]string{"passwall.@global[0].enabled": "0"}, false},
+		{"missing node", ruleMode, map[string]string{"passwall.@global[0].enabled": "1"}, false},
+		{"disable matches", disable, map[string]string{"passwall.@global[0].enabled": "0"}, true},
+		{"disable while enabled", disable, enabled("node1", "dnsmasq"), false},
+		{"uci unavailable", disable, nil, false},
+	}
+	for _, tt := range tests {
+		if got := passwallInState(tt.config, uci(tt.uci)); got != tt.want {
+			t.Errorf("%s: passwallInState = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,17 +2,22 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"net/http"
+	"net/url"
 	"os/exec"
 	"strconv"
 	"strings"
 	"time"
 	"sync"
 	"github.com/fsnotify/fsnotify"
+
+	"cumtnet/scheduler"
 )
 
 // 定义全局变量
@@ -24,14 +29,49 @@ type Config struct {
 	Enabled   bool
 	Time      string
 	Weekdays  []int
+	Cron      string // cron 表达式，配置后代替 Time 和 Weekdays
+}
+// globalConfig 对应 cumt_login 全局配置块
+type globalConfig struct {
+	PortalURL string // 默认的 ePortal 地址
+	// portal 请求的超时时间
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	RequestTimeout time.Duration
+	SecretKeyPath  string // 解密 password_enc 的设备密钥
+	Timezone       string // 调度和日志使用的时区，缺省时读取系统时区
+	CatchUp        bool   // 启动和重新加载后补执行每个目标最近一次错过的规则
 }
 // Login Config
 type loginConfig struct {
 	Config
-	Action    string
+	PortalURL  string
+	PortalType string // portal 驱动，默认为 eportal
+	ACID       string // 深澜 portal 的 ac_id
+	Service    string // 锐捷 portal 的服务名
+	Action     string
 	ISP       string
 	Account   string
 	Password  string
+	PasswordFile string // 从仅 root 可读的文件读取密码
+	PasswordEnc  string // 使用设备密钥加密的密码
+	// 主账号被拒绝时依次尝试的备用账号
+	BackupAccounts []loginAccount
+	// 掉线检测
+	Keepalive         bool
+	KeepaliveInterval int    // 检测间隔（秒）
+	ProbeURL          string // 用于检测 portal 劫持的探测地址
+	PortalDiscover    bool   // 通过探测地址的劫持跳转自动发现 portal
+	// 多线路时绑定认证请求的出口
+	Interface string // 网络设备名或 OpenWrt 逻辑接口名
+	SourceIP  string // 本地源地址，优先于 Interface
+	// 登录失败时的重试策略
+	Retries      int
+	RetryBackoff time.Duration
+	RetryMax     time.Duration // 重试总时长上限
+	// 在线数超限时通过自助服务系统下线其他会话
+	KickOthers bool
+	SelfURL    string // 自助服务系统地址，默认为 portal 主机的 8080 端口
 }
 // passwall Config
 type passwallConfig struct {
@@ -43,38 +83,36 @@ type passwallConfig struct {
 
 var (
 	configLock sync.Mutex
+	globalSettings  globalConfig
 	loginConfigs    []loginConfig
 	passwallConfigs []passwallConfig
 )
 
-//定义任务管理结构
-var (
-	taskLock   sync.Mutex
-	taskRunners = make(map[string]chan bool) // 用于控制任务的启动与停止
-)
-
 // 自定义日志输出结构体
 type logWriter struct {
 	file *os.File
-	loc  *time.Location
 }
 
 // 实现 io.Writer 接口
 func (lw *logWriter) Write(p []byte) (n int, err error) {
-	// 获取当前时间，并使用自定义时区格式化
-	now := time.Now().In(lw.loc)
+	// 获取当前时间，并使用配置的时区格式化
+	now := localNow()
 	timeStamp := now.Format("2006-01-02 15:04:05.000000") // 定制时间格式
 
-	// 构建最终日志字符串
-	finalMessage := fmt.Sprintf("%s %s", timeStamp, p)
-	return lw.file.Write([]byte(finalMessage))
+	// 构建最终日志字符串，并遮盖其中的账号和密码
+	finalMessage := fmt.Sprintf("%s %s", timeStamp, redact(string(p)))
+	if _, err := lw.file.Write([]byte(finalMessage)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
 // ReadConfig reads the configuration file and returns a list of enabled configurations
-func ReadConfig(filePath string) ([]loginConfig, []passwallConfig, error) {
+func ReadConfig(filePath string) (globalConfig, []loginConfig, []passwallConfig, error) {
+	var global globalConfig
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, nil, err
+		return global, nil, nil, err
 	}
 	defer file.Close()
 
@@ -124,7 +162,11 @@ func ReadConfig(filePath string) ([]loginConfig, []passwallConfig, error) {
 						currentPasswallConfig = passwallConfig{} // 重置为默认值
 					}
 					inBlock = true // 标记进入块
-			
+
+				case "cumt_login":
+					// 全局配置块，直接写入 global
+					inBlock = true
+
 				default:
 					// 非 login 或 passwall 配置类型，忽略并重置块
 					currentLoginConfig = loginConfig{}
@@ -147,6 +189,30 @@ func ReadConfig(filePath string) ([]loginConfig, []passwallConfig, error) {
 				key := parts[1]
 				value := strings.Trim(strings.Join(parts[2:], " "), "'")
 				switch configType {
+				case "cumt_login":
+					switch key {
+					case "portal_url":
+						global.PortalURL = value
+					case "connect_timeout":
+						if d, ok := parseDurationOption(value); ok {
+							global.ConnectTimeout = d
+						}
+					case "read_timeout":
+						if d, ok := parseDurationOption(value); ok {
+							global.ReadTimeout = d
+						}
+					case "timeout":
+						if d, ok := parseDurationOption(value); ok {
+							global.RequestTimeout = d
+						}
+					case "secret_key":
+						global.SecretKeyPath = value
+					case "timezone":
+						global.Timezone = value
+					case "catchup":
+						global.CatchUp = value == "1"
+					}
+
 				case "login":
 					switch key {
 					case "enable":
@@ -155,14 +221,58 @@ func ReadConfig(filePath string) ([]loginConfig, []passwallConfig, error) {
 						currentLoginConfig.Action = value
 					case "isp":
 						currentLoginConfig.ISP = value
+					case "portal_url":
+						currentLoginConfig.PortalURL = value
+					case "portal_type":
+						currentLoginConfig.PortalType = value
+					case "ac_id":
+						currentLoginConfig.ACID = value
+					case "service":
+						currentLoginConfig.Service = value
 					case "account":
 						currentLoginConfig.Account = value
 					case "password":
 						currentLoginConfig.Password = value
+					case "password_file":
+						currentLoginConfig.PasswordFile = value
+					case "password_enc":
+						currentLoginConfig.PasswordEnc = value
+					case "keepalive":
+						currentLoginConfig.Keepalive = value == "1"
+					case "keepalive_interval":
+						if interval, err := strconv.Atoi(value); err == nil {
+							currentLoginConfig.KeepaliveInterval = interval
+						}
+					case "probe_url":
+						currentLoginConfig.ProbeURL = value
+					case "portal_discover":
+						currentLoginConfig.PortalDiscover = value == "1"
+					case "kick_others":
+						currentLoginConfig.KickOthers = value == "1"
+					case "self_url":
+						currentLoginConfig.SelfURL = value
+					case "interface":
+						currentLoginConfig.Interface = value
+					case "source_ip":
+						currentLoginConfig.SourceIP = value
+					case "retries":
+						if retries, err := strconv.Atoi(value); err == nil && retries >= 0 {
+							currentLoginConfig.Retries = retries
+						}
+					case "retry_backoff":
+						if d, ok := parseDurationOption(value); ok {
+							currentLoginConfig.RetryBackoff = d
+						}
+					case "retry_max":
+						if d, ok := parseDurationOption(value); ok {
+							currentLoginConfig.RetryMax = d
+						}
 					case "time":
 						currentLoginConfig.Time = value
 					case "weekdays":
 						currentLoginConfig.Weekdays = ParseWeekdays(value)
+					case "cron":
+						currentLoginConfig.Cron = value
 					}
 		
 				case "passwall":
@@ -179,7 +289,20 @@ func ReadConfig(filePath string) ([]loginConfig, []passwallConfig, error) {
 						currentPasswallConfig.Time = value
 					case "weekdays":
 						currentPasswallConfig.Weekdays = ParseWeekdays(value)
+					case "cron":
+						currentPasswallConfig.Cron = value
+					}
+				}
+			} else if len(parts) >= 3 && parts[0] == "list" && configType == "login" {
+				key := parts[1]
+				value := strings.Trim(strings.Join(parts[2:], " "), "'")
+				switch key {
+				case "backup_account":
+					account, err := parseBackupAccount(value)
+					if err != nil {
+						return global, nil, nil, fmt.Errorf("Login [%s] %v", currentLoginConfig.ID, err)
 					}
+					currentLoginConfig.BackupAccounts = append(currentLoginConfig.BackupAccounts, account)
 				}
 			}
 		}
@@ -196,10 +319,82 @@ func ReadConfig(filePath string) ([]loginConfig, []passwallConfig, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, nil, err
+		return global, nil, nil, err
 	}
 
-	return loginConfigs, passwallConfigs, nil
+	// 匿名块按 uci 的写法命名为 @login[N]、@passwall[N]，同类型的块不能重名
+	loginIDs := make(map[string]bool)
+	for i := range loginConfigs {
+		if loginConfigs[i].ID == "" {
+			loginConfigs[i].ID = fmt.Sprintf("@login[%d]", i)
+		}
+		if loginIDs[loginConfigs[i].ID] {
+			return global, nil, nil, fmt.Errorf("Login [%s] 重复定义", loginConfigs[i].ID)
+		}
+		loginIDs[loginConfigs[i].ID] = true
+	}
+	passwallIDs := make(map[string]bool)
+	for i := range passwallConfigs {
+		if passwallConfigs[i].ID == "" {
+			passwallConfigs[i].ID = fmt.Sprintf("@passwall[%d]", i)
+		}
+		if passwallIDs[passwallConfigs[i].ID] {
+			return global, nil, nil, fmt.Errorf("Passwall [%s] 重复定义", passwallConfigs[i].ID)
+		}
+		passwallIDs[passwallConfigs[i].ID] = true
+	}
+
+	// 校验 portal 地址，未配置时依次使用全局配置和默认值
+	if global.PortalURL == "" {
+		global.PortalURL = DefaultPortalURL
+	} else if global.PortalURL, err = normalizePortalURL(global.PortalURL); err != nil {
+		return global, nil, nil, fmt.Errorf("全局配置 portal_url 无效: %v", err)
+	}
+	for i := range loginConfigs {
+		if err := loginConfigs[i].resolvePassword(global.SecretKeyPath); err != nil {
+			return global, nil, nil, fmt.Errorf("Login [%s] %v", loginConfigs[i].ID, err)
+		}
+		if loginConfigs[i].PortalType == "" {
+			loginConfigs[i].PortalType = DefaultPortalType
+		}
+		if _, ok := authenticators[loginConfigs[i].PortalType]; !ok {
+			return global, nil, nil, fmt.Errorf("Login [%s] 不支持的 portal_type: %s", loginConfigs[i].ID, loginConfigs[i].PortalType)
+		}
+		if loginConfigs[i].PortalURL == "" {
+			// 全局 portal 地址仅适用于 ePortal，其他驱动需要单独配置
+			if loginConfigs[i].PortalType != DefaultPortalType {
+				return global, nil, nil, fmt.Errorf("Login [%s] portal_type 为 %s 时必须配置 portal_url", loginConfigs[i].ID, loginConfigs[i].PortalType)
+			}
+			loginConfigs[i].PortalURL = global.PortalURL
+			continue
+		}
+		if loginConfigs[i].PortalURL, err = normalizePortalURL(loginConfigs[i].PortalURL); err != nil {
+			return global, nil, nil, fmt.Errorf("Login [%s] portal_url 无效: %v", loginConfigs[i].ID, err)
+		}
+	}
+
+	return global, loginConfigs, passwallConfigs, nil
+}
+
+// normalizePortalURL 检查 portal 地址是否为合法的 http(s) 地址，并将结尾的多个斜杠合并为一个，
+// ePortal 请求直接在地址后拼接查询字符串，需要以 / 结尾
+func normalizePortalURL(portalURL string) (string, error) {
+	u, err := url.Parse(portalURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("不支持的协议: %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("缺少主机地址")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("不能包含查询字符串")
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/"
+	u.RawPath = ""
+	return u.String(), nil
 }
 
 
@@ -215,66 +410,115 @@ func ParseWeekdays(input string) []int {
 	return weekdays
 }
 
-// BaseURL 定义基础的 IP 和端口部分
-const BaseURL = "http://10.2.5.251:801/eportal/"
+// DefaultPortalURL 定义默认的 ePortal 地址，可通过 portal_url 覆盖
+const DefaultPortalURL = "http://10.2.5.251:801/eportal/"
 
 // sendLoginRequest sends the login HTTP request for a given configuration
-func sendLoginRequest(config loginConfig) {
-	var url string
-
+// and returns the classified ePortal result
+func sendLoginRequest(ctx context.Context, config loginConfig) (*loginResult, error) {
 	if config.Action == "logout" {
-		// 如果 Action 是 logout，使用特定 URL，不包含账号、密码和运营商信息
-		url = fmt.Sprintf("%s?c=Portal&a=logout&login_method=1&user_account=drcom&user_password=123", BaseURL)
-	} else {
-		// 判断是否需要 ISP
-		if config.ISP == "cumt" {
-			// 如果 ISP 是 cumt，不添加 ISP 值
-			url = fmt.Sprintf(
-				"%s?c=Portal&a=%s&login_method=1&user_account=%s%%40&user_password=%s",
-				BaseURL, config.Action, config.Account, config.Password,
-			)
-		} else {
-			// 如果 ISP 不为 cumt，正常拼接 ISP 值
-			url = fmt.Sprintf(
-				"%s?c=Portal&a=%s&login_method=1&user_account=%s%%40%s&user_password=%s",
-				BaseURL, config.Action, config.Account, config.ISP, config.Password,
-			)
+		return sendLogoutRequest(ctx, config)
+	}
+
+	// 使用绑定到指定接口或源地址的客户端
+	client, sourceIP, err := portalClientFor(config)
+	if err != nil {
+		log.Printf("[%s] 无法确定源地址: %v\n", config.ID, err)
+		return nil, err
+	}
+
+	// 自动发现 portal 地址和终端参数
+	params := url.Values{}
+	if config.PortalDiscover {
+		info, err := discoverPortal(ctx, client, config.probeTarget())
+		switch {
+		case err == nil:
+			log.Printf("[%s] 发现 portal: %s, 跳转地址: %s", config.ID, info.PortalURL, info.Redirect)
+			config.PortalURL = info.PortalURL
+			params = info.loginParams()
+		case err == errNotIntercepted:
+			log.Printf("[%s] 未被 portal 劫持，使用配置的 portal 地址", config.ID)
+		default:
+			log.Printf("[%s] 发现 portal 失败，使用配置的 portal 地址: %v", config.ID, err)
 		}
 	}
 
-	log.Printf("[%s] 请求的 URL: %s", config.ID, url)
+	requestURL := config.PortalURL + "?" + buildLoginQuery(config.Action, config.Account, config.ISP, config.Password)
+	// 绑定源地址时由该地址完成认证
+	if sourceIP != nil {
+		params.Set("wlan_user_ip", sourceIP.String())
+	}
+	if len(params) > 0 {
+		requestURL += "&" + params.Encode()
+	}
+
+	return requestPortal(ctx, client, config, requestURL)
+}
+
+// requestPortal 向 ePortal 发送 GET 请求并解析返回结果
+func requestPortal(ctx context.Context, client *http.Client, config loginConfig, requestURL string) (*loginResult, error) {
+	log.Printf("[%s] 请求的 URL: %s", config.ID, requestURL)
 
 	// 发送 HTTP GET 请求
-	resp, err := http.Get(url)
+	resp, err := httpGet(ctx, client, requestURL)
 	if err != nil {
+		err = classifyRequestError(err)
 		log.Printf("[%s] 请求失败: %v\n", config.ID, err)
-		return
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// 检查响应状态
-	if resp.StatusCode == http.StatusOK {
-		log.Printf("[%s] 请求成功\n", config.ID)
-	} else {
+	if resp.StatusCode != http.StatusOK {
 		log.Printf("[%s] 请求失败，状态码: %d\n", config.ID, resp.StatusCode)
+		return nil, fmt.Errorf("状态码: %d", resp.StatusCode)
+	}
+
+	// ePortal 即使认证失败也返回 200，需要解析响应体判断真实结果
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		err = classifyRequestError(err)
+		log.Printf("[%s] 读取响应失败: %v\n", config.ID, err)
+		return nil, err
 	}
+	result, err := parseLoginResponse(body)
+	if err != nil {
+		log.Printf("[%s] %v, 响应内容: %s\n", config.ID, err, body)
+		return nil, err
+	}
+
+	if result.OK() {
+		log.Printf("[%s] 请求成功: %s\n", config.ID, result)
+	} else {
+		log.Printf("[%s] 请求被拒绝: %s\n", config.ID, result)
+	}
+	return result, nil
 }
 
 // execPasswallCommand
-func execPasswallCommand(config passwallConfig) {
+func execPasswallCommand(ctx context.Context, config passwallConfig) {
+	// 任务被停止导致命令中断时只放弃本次执行，其他失败仍然退出
+	fatal := func(format string, err error) {
+		if ctx.Err() != nil {
+			log.Printf("[%s] 任务已停止，放弃更新 Passwall: %v\n", config.ID, err)
+			return
+		}
+		log.Fatalf(format, err)
+	}
     if config.Action == "enable" {
 		// 示例：选择 global 配置集并更新配置
-		err := updatePasswallConfig(config.Mode, config.Node, config.Node)
+		err := updatePasswallConfig(ctx, config.Mode, config.Node, config.Node)
 		if err != nil {
-			log.Fatalf("更新配置失败: %v", err)
+			fatal("更新配置失败: %v", err)
+			return
 		} else {
 			log.Println("配置更新成功")
 		}
     } else if config.Action == "disable" {
         // 修改配置项，将 enabled 设置为 0
-		err := executeUciCommand("uci", []string{"set", "passwall.@global[0].enabled=0"})
+		err := executeUciCommand(ctx, "uci", []string{"set", "passwall.@global[0].enabled=0"})
 		if err != nil {
-			log.Fatalf("更新配置失败: %v", err)
+			fatal("更新配置失败: %v", err)
 			return
 		}
         log.Println("Passwall 已禁用")
@@ -284,16 +528,16 @@ func execPasswallCommand(config passwallConfig) {
     }
 
 	// 提交更改
-	err := executeUciCommand("uci", []string{"commit", "passwall"})
+	err := executeUciCommand(ctx, "uci", []string{"commit", "passwall"})
 	if err != nil {
-		log.Fatalf("提交配置失败: %v", err)
+		fatal("提交配置失败: %v", err)
 		return
 	}
 
 	// 重启 passwall 服务
-	err = executeUciCommand("/etc/init.d/passwall", []string{"restart"})
+	err = executeUciCommand(ctx, "/etc/init.d/passwall", []string{"restart"})
 	if err != nil {
-		log.Fatalf("重启 passwall 服务失败: %v", err)
+		fatal("重启 passwall 服务失败: %v", err)
 		return
 	}
 	
@@ -302,96 +546,69 @@ func execPasswallCommand(config passwallConfig) {
 }
 
 
-// scheduleLoginTaskWithRefresh schedules tasks and refreshes the next execution time after each execution
-func scheduleLoginTaskWithRefresh(config loginConfig) {
-    for {
-        nextTime, err := nextExecutionTime(config.Weekdays, config.Time)
-        if err != nil {
-            log.Printf("[%s] 无法计算下次执行时间: %v\n", config.ID, err)
-            return
-        }
+// runLoginTask 先查询 portal 在线状态，只在需要时执行登录或注销
+func runLoginTask(ctx context.Context, config loginConfig) {
+	// 使用当前正在使用的账号查询状态和注销
+	active, _ := config.activeAccount()
+	current := config.withAccount(active)
 
-        // 计算等待时间
-        duration := time.Until(nextTime)
-        log.Printf("[%s] Login 任务已调度: %s\n", config.ID, nextTime.Format("2006-01-02 15:04:05"))
-        time.Sleep(duration) // 等待到指定时间
-
-        // 执行任务
-        log.Printf("[%s] 正在执行Login任务...\n", config.ID)
-        sendLoginRequest(config)
-
-        // 任务完成后重新计算时间
-        log.Printf("[%s] Login 任务完成，重新计算下次执行时间\n", config.ID)
-    }
-}
-
-// nextExecutionTime calculates the next execution time based on weekdays and time of day
-func nextExecutionTime(weekdays []int, timeOfDay string) (time.Time, error) {
-    now := time.Now().In(time.Local) // 明确指定使用本地时区
-    loc := now.Location()
-
-    // 解析配置中的时间
-    configTime, err := time.ParseInLocation("15:04:05", timeOfDay, loc)
-    if err != nil {
-		log.Printf("无效的时间格式: %v", err)
-        return time.Time{}, fmt.Errorf("无效的时间格式: %v", err)
-    }
-
-    // 当前时间的日期部分与配置时间的时间部分合并
-    todayTime := time.Date(now.Year(), now.Month(), now.Day(), configTime.Hour(), configTime.Minute(), configTime.Second(), 0, loc)
-
-    // 检查今天是否符合条件
-    weekday := int(now.Weekday())
-    for _, w := range weekdays {
-        if w == weekday && todayTime.After(now) {
-            return todayTime, nil // 今天符合条件，且时间未过
-        }
-    }
+	auth, err := newAuthenticator(current)
+	if err != nil {
+		log.Printf("[%s] %v\n", config.ID, err)
+		return
+	}
 
-    // 如果今天不符合条件或时间已过，寻找下一个符合条件的星期
-    for i := 1; i <= 7; i++ {
-        nextDay := now.AddDate(0, 0, i)
-        nextWeekday := int(nextDay.Weekday())
-        for _, w := range weekdays {
-            if w == nextWeekday {
-                return time.Date(nextDay.Year(), nextDay.Month(), nextDay.Day(), configTime.Hour(), configTime.Minute(), configTime.Second(), 0, loc), nil
-            }
-        }
-    }
-	log.Printf("未找到下次执行时间")
-	return time.Time{}, fmt.Errorf("未找到下次执行时间")
-}
+	status, err := auth.Status(ctx)
+	if err != nil {
+		log.Printf("[%s] 查询在线状态失败，继续执行: %v\n", config.ID, err)
+	} else {
+		log.Printf("[%s] portal 当前状态: %s\n", config.ID, status)
+		if config.Action == "logout" && !status.Online {
+			log.Printf("[%s] 当前未在线，跳过注销\n", config.ID)
+			recordLoginResult(config.ID, nil, nil)
+			return
+		}
+		if config.Action != "logout" && status.Online {
+			if config.ownsAccount(status) {
+				log.Printf("[%s] 账号 %s 已在线，跳过登录\n", config.ID, status.Account)
+				recordLoginResult(config.ID, nil, nil)
+				refreshUsage(ctx, config)
+				return
+			}
+			log.Printf("[%s] 当前在线账号 %s 与配置账号不一致\n", config.ID, status.Account)
+		}
+	}
 
-// schedulePasswallTaskWithRefresh schedules tasks and refreshes the next execution time after each execution
-func schedulePasswallTaskWithRefresh(config passwallConfig) {
-    for {
-        nextTime, err := nextExecutionTime(config.Weekdays, config.Time)
-        if err != nil {
-            log.Printf("[%s] 无法计算下次执行时间: %v\n", config.ID, err)
-            return
-        }
-
-        // 计算等待时间
-        duration := time.Until(nextTime)
-        log.Printf("[%s] Passwall 任务已调度: %s\n", config.ID, nextTime.Format("2006-01-02 15:04:05"))
-        time.Sleep(duration) // 等待到指定时间
-
-        // 执行任务
-        log.Printf("[%s] 正在执行Passwall任务...\n", config.ID)
-        execPasswallCommand(config)
-
-        // 任务完成后重新计算时间
-        log.Printf("[%s] Passwall任务完成，重新计算下次执行时间\n", config.ID)
-    }
+	var result *loginResult
+	if config.Action == "logout" {
+		result, err = loginWithRetry(ctx, auth, current)
+	} else {
+		result, err = loginWithFailover(ctx, config)
+	}
+	// 任务已被停止时不再记录被中断的结果
+	if ctx.Err() != nil {
+		log.Printf("[%s] 任务已停止，不记录本次结果\n", config.ID)
+		return
+	}
+	if err == nil && !result.OK() {
+		log.Printf("[%s] Login 任务未达到预期状态: %s\n", config.ID, result)
+	}
+	recordLoginResult(config.ID, result, err)
+	if config.Action != "logout" && err == nil && result.OK() {
+		refreshUsage(ctx, config)
+	}
 }
 
-func containsValidWeekday(weekdays []int) bool {
-    for _, day := range weekdays {
-        if day >= 0 && day <= 6 { // 有效星期几是 0 到 6
-            return true
-        }
-    }
-    return false
+// schedule 返回规则的执行计划：配置了 cron 时使用 cron 表达式，否则使用 weekdays 和 time
+func (c Config) schedule() (scheduler.Schedule, error) {
+	if c.Cron != "" {
+		cron, err := scheduler.ParseCron(c.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 cron 表达式: %v", err)
+		}
+		return cron, nil
+	}
+	return scheduler.ParseWeekly(c.Weekdays, c.Time)
 }
 
 func watchConfigFile(filePath string) {
@@ -412,10 +629,14 @@ func watchConfigFile(filePath string) {
 			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
 				log.Println("配置文件已修改，重新加载配置...")
 				configLock.Lock()
-				loadedLoginConfigs, loadedPasswallConfigs, err := ReadConfig(filePath)
+				loadedGlobal, loadedLoginConfigs, loadedPasswallConfigs, err := ReadConfig(filePath)
 				if err != nil {
 					log.Printf("重新加载配置失败: %v\n", err)
 				} else {
+					globalSettings = loadedGlobal
+					configureTimezone(globalSettings)
+					configureHTTPClients(globalSettings)
+					registerSecrets(loadedLoginConfigs)
 					loginConfigs = loadedLoginConfigs
 					passwallConfigs = loadedPasswallConfigs
 					log.Println("配置文件已重新加载，新的配置项如下：")
@@ -433,16 +654,6 @@ func watchConfigFile(filePath string) {
 	}
 }
 
-func stopAllTasks() {
-	taskLock.Lock()
-	defer taskLock.Unlock()
-
-	for id, stopChan := range taskRunners {
-		close(stopChan) // 发送停止信号
-		log.Printf("任务 [%s] 已停止", id)
-	}
-	taskRunners = make(map[string]chan bool) // 清空任务管理
-}
 
 
 func updateTaskRunners(loginConfigs []loginConfig, passwallConfigs []passwallConfig) {
@@ -450,41 +661,49 @@ func updateTaskRunners(loginConfigs []loginConfig, passwallConfigs []passwallCon
 	log.Println("停止所有当前任务...")
 	stopAllTasks()
 
-	// 重新启动任务
-	taskLock.Lock()
-	defer taskLock.Unlock()
-
     // 启动 login 任务
+	var keepalives []loginConfig
+	uplinkRules := make(map[string][]uplinkRule) // 按出口记录定时规则，供掉线检测判断是否应保持在线
 	for _, config := range loginConfigs {
 		if config.Enabled {
+			// 掉线检测任务独立于定时任务运行，注销规则不需要掉线检测
+			if config.Keepalive && config.Action == "logout" {
+				log.Printf("Login [%s] 为注销规则，忽略 keepalive\n", config.ID)
+			} else if config.Keepalive {
+				keepalives = append(keepalives, config)
+			}
+
 			// 筛选条件和校验逻辑
-			if len(config.Weekdays) == 0 || !containsValidWeekday(config.Weekdays) {
-				log.Printf("Login [%s] 跳过：没有指定有效的星期\n", config.ID)
+			if config.Keepalive && config.Time == "" && len(config.Weekdays) == 0 && config.Cron == "" {
+				// 仅启用掉线检测，无需定时任务
 				continue
 			}
-
-			if _, err := time.Parse("15:04:05", config.Time); err != nil {
-				log.Printf("Login [%s] 跳过：无效的时间格式: %v\n", config.ID, err)
+			schedule, err := config.schedule()
+			if err != nil {
+				log.Printf("Login [%s] 跳过：%v\n", config.ID, err)
 				continue
 			}
 
 			// 启动新任务
-			stopChan := make(chan bool)
-			taskRunners[config.ID] = stopChan
-			go func(cfg loginConfig, stopChan chan bool) {
-				for {
-					select {
-					case <-stopChan:
-						log.Printf("Login 任务 [%s] 已停止", cfg.ID)
-						return
-					default:
-						scheduleLoginTaskWithRefresh(cfg)
-					}
-				}
-			}(config, stopChan)
+			tasks.Add(&loginJob{config: config, schedule: schedule})
 			log.Printf("Login 任务 [%s] 已启动", config.ID)
+			uplink := config.uplink()
+			uplinkRules[uplink] = append(uplinkRules[uplink], uplinkRule{ID: config.ID, Action: config.Action, Schedule: schedule})
 		}
 	}
+	for _, config := range keepalives {
+		startKeepaliveTask(config, uplinkRules[config.uplink()])
+	}
+
+	// 清理已删除规则的运行状态
+	ruleKeys := make(map[string]bool)
+	for _, config := range loginConfigs {
+		ruleKeys[ruleKey("login", config.ID)] = true
+	}
+	for _, config := range passwallConfigs {
+		ruleKeys[ruleKey("passwall", config.ID)] = true
+	}
+	pruneRuleStates(ruleKeys)
 
 	// 如果passwall 能正常配置
 	if passwallTaskEnable {
@@ -492,35 +711,23 @@ func updateTaskRunners(loginConfigs []loginConfig, passwallConfigs []passwallCon
 		for _, config := range passwallConfigs {
 			if config.Enabled {
 				// 筛选条件和校验逻辑
-				if len(config.Weekdays) == 0 || !containsValidWeekday(config.Weekdays) {
-					log.Printf("Passwall [%s] 跳过：没有指定有效的星期\n", config.ID)
-					continue
-				}
-
-				if _, err := time.Parse("15:04:05", config.Time); err != nil {
-					log.Printf("Passwall [%s] 跳过：无效的时间格式: %v\n", config.ID, err)
+				schedule, err := config.schedule()
+				if err != nil {
+					log.Printf("Passwall [%s] 跳过：%v\n", config.ID, err)
 					continue
 				}
 
 				// 启动新任务
-				stopChan := make(chan bool)
-				taskRunners[config.ID] = stopChan
-				go func(cfg passwallConfig, stopChan chan bool) {
-					for {
-						select {
-						case <-stopChan:
-							log.Printf("Passwall 任务 [%s] 已停止", cfg.ID)
-							return
-						default:
-							schedulePasswallTaskWithRefresh(cfg)
-						}
-					}
-				}(config, stopChan)
+				tasks.Add(&passwallJob{config: config, schedule: schedule})
 				log.Printf("Passwall 任务 [%s] 已启动", config.ID)
 			}
 		}
 	}
 
+	// 补执行重启或重新加载期间错过的规则
+	if globalSettings.CatchUp {
+		tasks.Add(planCatchUp(tasks.Clock().Now(), loginConfigs, passwallConfigs))
+	}
 }
 
 
@@ -530,24 +737,32 @@ func printLoginConfigs(configs []loginConfig) {
 	for _, config := range configs {
 		log.Printf("ID: %s", config.ID)
 		log.Printf("Enabled: %t", config.Enabled)
+		log.Printf("Portal: %s (%s)", config.PortalURL, config.PortalType)
 		log.Printf("Action: %s", config.Action)
 		log.Printf("ISP: %s", config.ISP)
-		log.Printf("Account: %s", config.Account)
-		log.Printf("Password: %s", config.Password)
+		log.Printf("Account: %s", maskAccount(config.Account))
+		log.Printf("Backup accounts: %d", len(config.BackupAccounts))
+		log.Printf("Password: %s", maskPassword(config.Password))
 		log.Printf("Time: %s", config.Time)
 		log.Printf("Weekdays: %v", config.Weekdays)
+		log.Printf("Cron: %s", config.Cron)
+		log.Printf("Keepalive: %t", config.Keepalive)
 		log.Println("----------------------------------------")
 	}
 	fmt.Println("当前Login配置项：")
 	for _, config := range configs {
 		fmt.Printf("ID: %s\n", config.ID)
 		fmt.Printf("Enabled: %t\n", config.Enabled)
+		fmt.Printf("Portal: %s (%s)\n", config.PortalURL, config.PortalType)
 		fmt.Printf("Action: %s\n", config.Action)
 		fmt.Printf("ISP: %s\n", config.ISP)
-		fmt.Printf("Account: %s\n", config.Account)
-		fmt.Printf("Password: %s\n", config.Password)
+		fmt.Printf("Account: %s\n", maskAccount(config.Account))
+		fmt.Printf("Backup accounts: %d\n", len(config.BackupAccounts))
+		fmt.Printf("Password: %s\n", maskPassword(config.Password))
 		fmt.Printf("Time: %s\n", config.Time)
 		fmt.Printf("Weekdays: %v\n", config.Weekdays)
+		fmt.Printf("Cron: %s\n", config.Cron)
+		fmt.Printf("Keepalive: %t\n", config.Keepalive)
 		fmt.Println("----------------------------------------")
 	}
 }
@@ -562,6 +777,7 @@ func printPasswallConfigs(configs []passwallConfig) {
 		log.Printf("Mode: %s", config.Mode)
 		log.Printf("Time: %s", config.Time)
 		log.Printf("Weekdays: %v", config.Weekdays)
+		log.Printf("Cron: %s", config.Cron)
 		log.Println("----------------------------------------")
 	}
 	fmt.Println("当前Passwall配置项：")
@@ -573,17 +789,28 @@ func printPasswallConfigs(configs []passwallConfig) {
 		fmt.Printf("Mode: %s\n", config.Mode)
 		fmt.Printf("Time: %s\n", config.Time)
 		fmt.Printf("Weekdays: %v\n", config.Weekdays)
+		fmt.Printf("Cron: %s\n", config.Cron)
 		fmt.Println("----------------------------------------")
 	}
 }
 
 
 func main() {
+	// 子命令
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fake-portal":
+			runFakePortal(os.Args[2:])
+			return
+		case "status":
+			runStatus(os.Args[2:])
+			return
+		case "encrypt-password":
+			runEncryptPassword(os.Args[2:])
+			return
+		}
+	}
 
-	// 设置全局时区为东八区
-	loc := time.FixedZone("CST", 8*3600) // CST: China Standard Time, +8小时
-	time.Local = loc // 设置全局时区
-	
 	// 打开日志文件
 	logFile, err := os.OpenFile("/tmp/cumt-net.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -602,21 +829,29 @@ func main() {
 
 	// 自定义日志格式化函数
 	log.SetFlags(0)
-	log.SetOutput(&logWriter{logFile, loc})
+	log.SetOutput(&logWriter{logFile})
 
 	// 定义一个命令行参数，用于指定配置文件路径
 	configFilePath := flag.String("config", "./config", "配置文件路径")
+	flag.BoolVar(&showSecrets, "show-secrets", false, "在日志和控制台中显示账号和密码，仅用于调试")
 	flag.Parse() // 解析命令行参数
 
 	// 输出用于调试的日志
 	log.Printf("使用的配置文件: %s\n", *configFilePath)
+	if showSecrets {
+		log.Println("警告: 已开启 -show-secrets，日志中会包含账号和密码")
+	}
 
 	// 读取配置文件
-	loginConfigs, passwallConfigs, err := ReadConfig(*configFilePath)
+	global, loginConfigs, passwallConfigs, err := ReadConfig(*configFilePath)
 	if err != nil {
 		log.Fatalf("读取配置文件失败: %v\n", err)
 		return
 	}
+	globalSettings = global
+	configureTimezone(globalSettings)
+	configureHTTPClients(globalSettings)
+	registerSecrets(loginConfigs)
 
 	// 初始化 passwallTaskEnable
 	initializePasswallTask()
@@ -652,7 +887,7 @@ func main() {
 // 初始化程序时检查配置并设置 passwallTaskEnable
 func initializePasswallTask() {
 	// 获取 passwall 配置项的值
-	_, err := getConfigValue()
+	_, err := uciGet("passwall.@global[0].enabled")
 	if err != nil {
 		log.Printf("获取passwall配置失败，设置 passwallTaskEnable 为 false: %v", err)
 		passwallTaskEnable = false
@@ -662,8 +897,8 @@ func initializePasswallTask() {
 }
 
 // 执行 uci 命令的通用函数
-func executeUciCommand(command string, args []string) error {
-	cmd := exec.Command(command, args...)
+func executeUciCommand(ctx context.Context, command string, args []string) error {
+	cmd := exec.CommandContext(ctx, command, args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Printf("命令失败: %s %v, 错误信息: %v", command, args, err)
@@ -674,20 +909,18 @@ func executeUciCommand(command string, args []string) error {
 	return nil
 }
 
-// 获取配置项的当前值
-func getConfigValue() (string, error) {
-	// 执行 uci get 命令获取当前值
-	cmd := exec.Command("uci", "get", "passwall.@global[0].enabled")
-	output, err := cmd.Output()
+// uciGet 读取 uci 配置项的当前值
+func uciGet(key string) (string, error) {
+	output, err := exec.Command("uci", "get", key).Output()
 	if err != nil {
-		return "", fmt.Errorf("failed to get config value: %v", err)
+		return "", fmt.Errorf("无法读取 %s: %v", key, err)
 	}
 	// 去除输出中的换行符
 	return strings.TrimSpace(string(output)), nil
 }
 
 // 更新 passwall 配置，根据 mode 选择不同的配置集
-func updatePasswallConfig(mode string, tcpNode string, udpNode string) error {
+func updatePasswallConfig(ctx context.Context, mode string, tcpNode string, udpNode string) error {
 	// 根据 mode 设置相应的配置内容
 	var useDirectList, useProxyList, useBlockList, useGfwList, dnsShunt, chnList, remoteDns, dnsRedirect, tcpRedirPorts string
 	if mode == "rule" {
@@ -774,7 +1007,10 @@ func updatePasswallConfig(mode string, tcpNode string, udpNode string) error {
 	
 	// 执行每条命令
 	for _, cmd := range commands {
-		err := executeUciCommand(cmd.command, cmd.args)
+		err := executeUciCommand(ctx, cmd.command, cmd.args)
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
 		if err != nil {
 			log.Fatalf("执行 uci 命令失败: %v", err)
 			return fmt.Errorf("执行 uci 命令失败: %v", err)
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTempConfig 将 UCI 配置写入临时文件并返回路径
+func writeTempConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cumt_login")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadConfigPortalURL(t *testing.T) {
+	const login = `
+config login 'work'
+	option enable '1'
+	option account '08200001'
+	option password 'pw'
+	option isp 'cumt'
+	option weekdays '1'
+	option time '08:15:00'
+`
+	tests := []struct {
+		name   string
+		global string // 全局配置块中的 option
+		rule   string // login 块中追加的 option
+		want   string // login 规则最终的 portal 地址
+		err    string // 期望的错误中包含的内容，空表示成功
+	}{
+		{name: "default", want: DefaultPortalURL},
+		{name: "global", global: "option portal_url 'http://10.0.0.1:801/eportal/'", want: "http://10.0.0.1:801/eportal/"},
+		{name: "rule overrides global", global: "option portal_url 'http://10.0.0.1:801/eportal/'",
+			rule: "option portal_url 'https://portal.example.edu/eportal/'", want: "https://portal.example.edu/eportal/"},
+		{name: "trailing slashes", rule: "option portal_url 'http://10.0.0.2:801/eportal///'", want: "http://10.0.0.2:801/eportal/"},
+		{name: "missing slash", global: "option portal_url 'http://10.0.0.3:801/eportal'", want: "http://10.0.0.3:801/eportal/"},
+		{name: "host only", rule: "option portal_url 'http://10.0.0.4'", want: "http://10.0.0.4/"},
+		{name: "non-http", rule: "option portal_url 'ftp://10.0.0.1/eportal/'", err: "portal_url 无效"},
+		{name: "no host", rule: "option portal_url 'http:///eportal/'", err: "portal_url 无效"},
+		{name: "malformed", global: "option portal_url 'http://10.0.0.1:80x/eportal/'", err: "全局配置 portal_url 无效"},
+		{name: "not a URL", rule: "option portal_url '10.2.5.251:801/eportal/'", err: "portal_url 无效"},
+		{name: "query string", rule: "option portal_url 'http://10.0.0.1/eportal/?c=Portal'", err: "portal_url 无效"},
+		{name: "srun without URL", rule: "option portal_type 'srun'", err: "必须配置 portal_url"},
+		{name: "srun", rule: "option portal_type 'srun'\n\toption portal_url 'http://10.0.0.5'", want: "http://10.0.0.5/"},
+	}
+	for _, tt := range tests {
+		content := "config cumt_login\n\t" + tt.global + "\n" + login + "\t" + tt.rule + "\n"
+		_, logins, _, err := ReadConfig(writeTempConfig(t, content))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: ReadConfig error = %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ReadConfig: %v", tt.name, err)
+			continue
+		}
+		if len(logins) != 1 || logins[0].PortalURL != tt.want {
+			t.Errorf("%s: portal_url = %v, want %s", tt.name, logins, tt.want)
+		}
+	}
+}
+
+func TestReadConfigRuleIDs(t *testing.T) {
+	path := writeTempConfig(t, `
+config login
+	option account '08200001'
+	option password 'pw'
+
+config login 'work'
+	option account '08200002'
+	option password 'pw'
+
+config passwall 'work'
+	option action 'enable'
+
+config login
+	option account '08200003'
+	option password 'pw'
+
+config passwall
+	option action 'disable'
+`)
+	_, logins, passwalls, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loginIDs, passwallIDs []string
+	for _, config := range logins {
+		loginIDs = append(loginIDs, config.ID)
+	}
+	for _, config := range passwalls {
+		passwallIDs = append(passwallIDs, config.ID)
+	}
+	if got, want := strings.Join(loginIDs, " "), "@login[0] work @login[2]"; got != want {
+		t.Errorf("login IDs = %s, want %s", got, want)
+	}
+	if got, want := strings.Join(passwallIDs, " "), "work @passwall[1]"; got != want {
+		t.Errorf("passwall IDs = %s, want %s", got, want)
+	}
+
+	// login 和 passwall 可以同名，任务和状态互不覆盖
+	login := &loginJob{config: logins[1]}
+	passwall := &passwallJob{config: passwalls[0]}
+	if login.ID() == passwall.ID() {
+		t.Errorf("login and passwall jobs share the ID %q", login.ID())
+	}
+	t.Cleanup(func() { pruneRuleStates(map[string]bool{}) })
+	recordLoginResult("work", &loginResult{Status: statusSuccess}, nil)
+	recordPasswallRun("work")
+	ruleStatesLock.Lock()
+	loginState, passwallState := ruleStates[ruleKey("login", "work")], ruleStates[ruleKey("passwall", "work")]
+	ruleStatesLock.Unlock()
+	if loginState == nil || loginState.LastResult != "success" || passwallState == nil || passwallState.LastResult != "done" {
+		t.Errorf("states = %+v, %+v; want separate login and passwall states", loginState, passwallState)
+	}
+
+	// 同类型的块重名时报错
+	duplicate := writeTempConfig(t, `
+config login 'work'
+	option account '08200001'
+
+config login 'work'
+	option account '08200002'
+`)
+	if _, _, _, err := ReadConfig(duplicate); err == nil || !strings.Contains(err.Error(), "重复") {
+		t.Errorf("ReadConfig with duplicate login sections: error = %v, want duplicate", err)
+	}
+}
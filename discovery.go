@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// errNotIntercepted 表示探测请求没有被 portal 劫持，无法从中发现 portal 地址
+var errNotIntercepted = errors.New("探测请求未被 portal 劫持")
+
+// portalInfo 保存从劫持跳转中发现的 portal 地址和终端参数
+type portalInfo struct {
+	PortalURL string // ePortal 接口地址，形如 http://host:801/eportal/
+	UserIP    string
+	UserMAC   string
+	ACIP      string
+	ACName    string
+	Redirect  string // 原始跳转地址
+}
+
+// loginParams 返回需要附加到 ePortal 登录请求中的终端参数
+func (p *portalInfo) loginParams() url.Values {
+	params := url.Values{}
+	if p.UserIP != "" {
+		params.Set("wlan_user_ip", p.UserIP)
+	}
+	if p.UserMAC != "" {
+		params.Set("wlan_user_mac", p.UserMAC)
+	}
+	if p.ACIP != "" {
+		params.Set("wlan_ac_ip", p.ACIP)
+	}
+	if p.ACName != "" {
+		params.Set("wlan_ac_name", p.ACName)
+	}
+	return params
+}
+
+// redirectPattern 匹配跳转页面中 JS 或 meta refresh 给出的地址
+var redirectPattern = regexp.MustCompile(`(?i)(?:location\.href\s*=|location\.replace\(|location\s*=|url=)\s*['"]?(https?://[^'"\s<>)]+)`)
+
+// discoverPortal 访问探测地址，根据 portal 的劫持跳转发现 portal 地址和参数
+func discoverPortal(ctx context.Context, client *http.Client, probeURL string) (*portalInfo, error) {
+	resp, err := httpGet(ctx, noRedirectClient(client), probeURL)
+	if err != nil {
+		return nil, classifyRequestError(err)
+	}
+	defer resp.Body.Close()
+
+	var redirect string
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		return nil, errNotIntercepted
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		redirect = resp.Header.Get("Location")
+	default:
+		// 部分 portal 返回 200 的跳转页面
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if err != nil {
+			return nil, classifyRequestError(err)
+		}
+		if m := redirectPattern.FindSubmatch(body); m != nil {
+			redirect = string(m[1])
+		}
+	}
+	if redirect == "" {
+		return nil, fmt.Errorf("未在探测响应中找到跳转地址，状态码: %d", resp.StatusCode)
+	}
+
+	// 跳转地址可能是相对地址
+	base, _ := url.Parse(probeURL)
+	target, err := base.Parse(strings.TrimSpace(redirect))
+	if err != nil {
+		return nil, fmt.Errorf("无效的跳转地址 %q: %v", redirect, err)
+	}
+	return parsePortalRedirect(target), nil
+}
+
+// parsePortalRedirect 从跳转地址中提取 ePortal 地址和终端参数
+func parsePortalRedirect(target *url.URL) *portalInfo {
+	query := target.Query()
+	info := &portalInfo{
+		UserIP:   firstParam(query, "wlan_user_ip", "wlanuserip", "userip"),
+		UserMAC:  normalizeMAC(firstParam(query, "wlan_user_mac", "wlanusermac", "usermac", "mac")),
+		ACIP:     firstParam(query, "wlan_ac_ip", "wlanacip", "acip"),
+		ACName:   firstParam(query, "wlan_ac_name", "wlanacname", "acname"),
+		Redirect: target.String(),
+	}
+
+	// 跳转到 ePortal 页面时保留其路径，否则使用 Dr.COM 默认的 801 端口
+	if i := strings.Index(target.Path, "/eportal/"); i >= 0 {
+		info.PortalURL = fmt.Sprintf("%s://%s%s", target.Scheme, target.Host, target.Path[:i+len("/eportal/")])
+	} else {
+		info.PortalURL = fmt.Sprintf("%s://%s:801/eportal/", target.Scheme, target.Hostname())
+	}
+	return info
+}
+
+// firstParam 返回第一个非空的查询参数
+func firstParam(query url.Values, keys ...string) string {
+	for _, key := range keys {
+		if v := query.Get(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// normalizeMAC 去掉 MAC 地址中的分隔符，ePortal 使用 12 位小写十六进制
+func normalizeMAC(mac string) string {
+	mac = strings.NewReplacer(":", "", "-", "", ".", "").Replace(mac)
+	return strings.ToLower(mac)
+}
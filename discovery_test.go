@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDiscoverPortal(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/online", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://10.2.5.251/a79.htm?wlanuserip=10.1.2.3&wlanacname=CUMT-AC&wlanacip=10.2.5.1&wlanusermac=AA-BB-CC-DD-EE-FF", http.StatusFound)
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><script>top.self.location.href='http://10.2.5.251:8080/eportal/index.html?wlan_user_ip=10.1.2.4&wlan_user_mac=00:11:22:33:44:55'</script></html>`))
+	})
+	mux.HandleFunc("/relative", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/eportal/?userip=10.1.2.5", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		path string
+		want portalInfo
+	}{
+		{"/redirect", portalInfo{PortalURL: "http://10.2.5.251:801/eportal/", UserIP: "10.1.2.3", UserMAC: "aabbccddeeff", ACIP: "10.2.5.1", ACName: "CUMT-AC"}},
+		{"/page", portalInfo{PortalURL: "http://10.2.5.251:8080/eportal/", UserIP: "10.1.2.4", UserMAC: "001122334455"}},
+		{"/relative", portalInfo{PortalURL: "http://" + host + "/eportal/", UserIP: "10.1.2.5"}},
+	}
+	for _, tt := range tests {
+		info, err := discoverPortal(context.Background(), server.Client(), server.URL+tt.path)
+		if err != nil {
+			t.Errorf("discoverPortal(context.Background(), %s): %v", tt.path, err)
+			continue
+		}
+		info.Redirect = ""
+		if *info != tt.want {
+			t.Errorf("discoverPortal(context.Background(), %s) = %+v, want %+v", tt.path, *info, tt.want)
+		}
+	}
+
+	if _, err := discoverPortal(context.Background(), server.Client(), server.URL+"/online"); err != errNotIntercepted {
+		t.Errorf("discoverPortal(context.Background(), /online) error = %v, want errNotIntercepted", err)
+	}
+}
+
+func TestPortalInfoLoginParams(t *testing.T) {
+	info := &portalInfo{UserIP: "10.1.2.3", UserMAC: "aabbccddeeff", ACName: "CUMT-AC"}
+	got := info.loginParams().Encode()
+	want := "wlan_ac_name=CUMT-AC&wlan_user_ip=10.1.2.3&wlan_user_mac=aabbccddeeff"
+	if got != want {
+		t.Errorf("loginParams() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ePortalAuthenticator 是 Dr.COM ePortal 的认证驱动
+type ePortalAuthenticator struct {
+	config loginConfig
+}
+
+func newEPortalAuthenticator(config loginConfig) Authenticator {
+	return &ePortalAuthenticator{config: config}
+}
+
+func (a *ePortalAuthenticator) Login(ctx context.Context) (*loginResult, error) {
+	config := a.config
+	config.Action = "login"
+	result, err := sendLoginRequest(ctx, config)
+	if err != nil || result.Status != statusIPInUse {
+		return result, err
+	}
+
+	// 地址已被占用时，只有在线的是规则中的账号才视为已在线
+	status, statusErr := a.Status(ctx)
+	if statusErr != nil {
+		log.Printf("[%s] 无法确认占用该地址的账号: %v\n", config.ID, statusErr)
+		return result, nil
+	}
+	if status.Online && config.ownsAccount(status) {
+		log.Printf("[%s] 该地址已由账号 %s 登录\n", config.ID, status.Account)
+		result.Status = statusAlreadyOnline
+	} else {
+		log.Printf("[%s] 该地址已被其他账号 %s 占用\n", config.ID, status.Account)
+	}
+	return result, nil
+}
+
+func (a *ePortalAuthenticator) Logout(ctx context.Context) (*loginResult, error) {
+	return sendLogoutRequest(ctx, a.config)
+}
+
+// Status 通过 login 配置绑定的接口查询 portal 在线状态
+func (a *ePortalAuthenticator) Status(ctx context.Context) (*portalStatus, error) {
+	client, _, err := portalClientFor(a.config)
+	if err != nil {
+		return nil, err
+	}
+	return queryPortalStatus(ctx, client, a.config.PortalURL)
+}
+
+// Usage 返回配置账号的使用情况，账号不在线时返回错误
+func (a *ePortalAuthenticator) Usage(ctx context.Context) (*accountUsage, error) {
+	return usageFromStatus(ctx, a, a.config.Account)
+}
+
+// usageFromStatus 查询在线状态并返回指定账号的使用情况
+func usageFromStatus(ctx context.Context, auth Authenticator, account string) (*accountUsage, error) {
+	status, err := auth.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !status.Online || !status.accountMatches(account) {
+		return nil, fmt.Errorf("账号 %s 不在线", account)
+	}
+	if status.Usage == nil {
+		return nil, fmt.Errorf("portal 未返回使用情况")
+	}
+	return status.Usage, nil
+}
+
+// loginStatus 表示 ePortal 返回结果的分类
+type loginStatus int
+
+const (
+	statusUnknown         loginStatus = iota // 无法识别的返回
+	statusSuccess                            // 认证成功
+	statusAlreadyOnline                      // 已经在线
+	statusBadCredentials                     // 账号或密码错误
+	statusTooManySessions                    // 在线终端数超限
+	statusQuotaExhausted                     // 流量或余额用尽
+	statusIPInUse                            // 终端地址已有会话，不一定是配置的账号
+)
+
+func (s loginStatus) String() string {
+	switch s {
+	case statusSuccess:
+		return "success"
+	case statusAlreadyOnline:
+		return "already_online"
+	case statusBadCredentials:
+		return "bad_credentials"
+	case statusTooManySessions:
+		return "too_many_sessions"
+	case statusQuotaExhausted:
+		return "quota_exhausted"
+	case statusIPInUse:
+		return "ip_in_use"
+	default:
+		return "unknown"
+	}
+}
+
+// loginResult 保存一次 ePortal 请求解析后的结果
+type loginResult struct {
+	Status  loginStatus
+	Result  string       // 原始 result 字段
+	RetCode string       // 原始 ret_code 字段
+	Msg     string       // msg 字段，若为 base64 则为解码后的内容
+	Raw     string       // 原始响应体
+	Err     *portalError // 已知的 portal 错误，未识别时为 nil
+}
+
+// OK 判断本次请求是否达到了期望的状态
+func (r *loginResult) OK() bool {
+	return r.Status == statusSuccess || r.Status == statusAlreadyOnline
+}
+
+func (r *loginResult) String() string {
+	s := fmt.Sprintf("%s (result=%s, ret_code=%s, msg=%q)", r.Status, r.Result, r.RetCode, r.Msg)
+	if r.Err != nil {
+		s += fmt.Sprintf(": %s / %s", r.Err.Chinese, r.Err.English)
+	}
+	return s
+}
+
+// retryable 判断该结果是否值得重试，已知错误以错误表中的标记为准
+func (r *loginResult) retryable() bool {
+	if r.Err != nil {
+		return r.Err.Retryable
+	}
+	return r.Status.retryable()
+}
+
+// jsonpPattern 匹配 dr1003({...}) 形式的 JSONP 响应，回调名可以为空
+var jsonpPattern = regexp.MustCompile(`(?s)^\s*[\w$.]*\s*\((.*)\)\s*;?\s*$`)
+
+// parseLoginResponse 解析 ePortal 返回的 JSONP 响应体并分类
+func parseLoginResponse(body []byte) (*loginResult, error) {
+	raw := strings.TrimSpace(string(body))
+	payload := raw
+	if m := jsonpPattern.FindStringSubmatch(raw); m != nil {
+		payload = m[1]
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &fields); err != nil {
+		return nil, fmt.Errorf("无法解析 ePortal 响应: %v", err)
+	}
+
+	result := &loginResult{
+		Result:  jsonField(fields, "result"),
+		RetCode: jsonField(fields, "ret_code"),
+		Msg:     decodePortalMsg(jsonField(fields, "msg")),
+		Raw:     raw,
+	}
+	result.Status, result.Err = classifyLoginResult(result)
+	return result, nil
+}
+
+// jsonField 将 JSON 字段统一转换为字符串，ePortal 有时返回数字有时返回字符串
+func jsonField(fields map[string]interface{}, key string) string {
+	v, ok := fields[key]
+	if !ok || v == nil {
+		return ""
+	}
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return fmt.Sprintf("%g", val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// decodePortalMsg 尝试对 base64 编码的 msg 解码，失败时原样返回
+func decodePortalMsg(msg string) string {
+	if msg == "" {
+		return ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(msg)
+	if err != nil || len(decoded) == 0 || !utf8.Valid(decoded) {
+		return msg
+	}
+	for _, r := range string(decoded) {
+		if !unicode.IsPrint(r) {
+			return msg
+		}
+	}
+	return string(decoded)
+}
+
+// classifyLoginResult 根据 result、ret_code 和 msg 判断登录结果
+func classifyLoginResult(r *loginResult) (loginStatus, *portalError) {
+	if r.Result == "1" || r.Result == "ok" {
+		return statusSuccess, nil
+	}
+	if r.RetCode == "2" {
+		return statusAlreadyOnline, nil
+	}
+	if e := lookupPortalError(r.Msg); e != nil {
+		return e.Status, e
+	}
+	return statusUnknown, nil
+}
+
+func containsAny(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// portalAccount 返回提交给 ePortal 的账号，形如 账号@运营商
+// 校园网（cumt）账号保留空的后缀，即 user_account=账号%40
+func portalAccount(account, isp string) string {
+	if isp == "cumt" {
+		return account + "@"
+	}
+	return account + "@" + isp
+}
+
+// buildLoginQuery 构造 ePortal 登录或注销请求的查询字符串，账号和密码均经过转义
+func buildLoginQuery(action, account, isp, password string) string {
+	query := "c=Portal" +
+		"&a=" + url.QueryEscape(action) +
+		"&login_method=1" +
+		"&user_account=" + url.QueryEscape(portalAccount(account, isp)) +
+		"&user_password=" + url.QueryEscape(password)
+	if action == "logout" {
+		// 同时要求 AC 下线该会话
+		query += "&ac_logout=1"
+	}
+	return query
+}
+
+// portalStatus 表示 ePortal 认为的当前在线状态
+type portalStatus struct {
+	Online  bool
+	Account string        // 在线账号，可能带有 @运营商 后缀
+	IP      string        // 绑定的 IPv4 地址
+	MAC     string        // 绑定的 MAC 地址
+	Usage   *accountUsage // 在线时的使用情况，portal 不提供时为 nil
+	Raw     string
+}
+
+func (s *portalStatus) String() string {
+	if !s.Online {
+		return fmt.Sprintf("offline (ip=%s)", s.IP)
+	}
+	return fmt.Sprintf("online (account=%s, ip=%s, mac=%s)", s.Account, s.IP, s.MAC)
+}
+
+// accountMatches 判断在线账号是否为配置中的账号，忽略 @运营商 后缀
+func (s *portalStatus) accountMatches(account string) bool {
+	online := s.Account
+	if i := strings.Index(online, "@"); i >= 0 {
+		online = online[:i]
+	}
+	return online != "" && online == account
+}
+
+// portalStatusURL 根据 ePortal 地址得到 Dr.COM chkstatus 接口地址
+// chkstatus 位于 80 端口，若 portal 使用默认的 801 端口则去掉端口号
+func portalStatusURL(portalURL string) (string, error) {
+	u, err := url.Parse(portalURL)
+	if err != nil {
+		return "", err
+	}
+	host := u.Host
+	if u.Port() == "801" {
+		host = u.Hostname()
+	}
+	return fmt.Sprintf("%s://%s/drcom/chkstatus?callback=dr1002", u.Scheme, host), nil
+}
+
+// queryPortalStatus 查询 ePortal 当前的在线状态
+func queryPortalStatus(ctx context.Context, client *http.Client, portalURL string) (*portalStatus, error) {
+	statusURL, err := portalStatusURL(portalURL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 portal 地址: %v", err)
+	}
+
+	resp, err := httpGet(ctx, client, statusURL)
+	if err != nil {
+		return nil, classifyRequestError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("状态码: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, classifyRequestError(err)
+	}
+	return parseStatusResponse(body)
+}
+
+// parseStatusResponse 解析 chkstatus 返回的 dr1002({...}) 响应
+func parseStatusResponse(body []byte) (*portalStatus, error) {
+	raw := strings.TrimSpace(string(body))
+	payload := raw
+	if m := jsonpPattern.FindStringSubmatch(raw); m != nil {
+		payload = m[1]
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &fields); err != nil {
+		return nil, fmt.Errorf("无法解析 chkstatus 响应: %v", err)
+	}
+
+	status := &portalStatus{
+		Online:  jsonField(fields, "result") == "1",
+		Account: jsonField(fields, "uid"),
+		IP:      jsonField(fields, "v46ip"),
+		MAC:     jsonField(fields, "olmac"),
+		Raw:     raw,
+	}
+	// 离线时 IP 位于 ss5 字段
+	if status.IP == "" {
+		status.IP = jsonField(fields, "ss5")
+	}
+	if status.Online {
+		// time 为在线分钟数，flow 为已用流量（KB），fee 为余额（万分之一元）
+		minutes := jsonNumber(fields, "time")
+		status.Usage = &accountUsage{
+			Account:       status.Account,
+			OnlineIP:      status.IP,
+			LoginTime:     localNow().Add(-time.Duration(minutes) * time.Minute).Format(statusTimeFormat),
+			OnlineMinutes: minutes,
+			UsedFlowMB:    jsonNumber(fields, "flow") / 1024,
+			RemainFlowMB:  -1,
+			Balance:       jsonNumber(fields, "fee") / 10000,
+		}
+	}
+	return status, nil
+}
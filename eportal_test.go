@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"cumtnet/fakeportal"
+)
+
+// newFakePortal 启动一个模拟 ePortal，测试结束时关闭
+func newFakePortal(t *testing.T, accounts ...fakeportal.Account) (*fakeportal.Server, string) {
+	t.Helper()
+	portal := fakeportal.New()
+	for _, account := range accounts {
+		portal.AddAccount(account)
+	}
+	server := httptest.NewServer(portal)
+	t.Cleanup(server.Close)
+	return portal, server.URL
+}
+
+// fakeLoginConfig 返回指向模拟 portal 的 login 配置，源地址固定为 127.0.0.1
+func fakeLoginConfig(baseURL, account, password string) loginConfig {
+	return loginConfig{
+		Config:     Config{ID: "test"},
+		PortalURL:  baseURL + "/eportal/",
+		PortalType: DefaultPortalType,
+		Action:     "login",
+		ISP:        "cumt",
+		Account:    account,
+		Password:   password,
+		SourceIP:   "127.0.0.1",
+	}
+}
+
+func TestParseLoginResponse(t *testing.T) {
+	tests := []struct {
+		body   string
+		status loginStatus
+		ok     bool
+	}{
+		{`dr1003({"result":"1","msg":"Portal协议认证成功！"})`, statusSuccess, true},
+		{`dr1003({"result":"0","msg":"","ret_code":2})`, statusAlreadyOnline, true},
+		{`dr1003({"result":"0","msg":"dXNlcmlkIGVycm9yMQ==","ret_code":1})`, statusBadCredentials, false},
+		{`dr1003({"result":"0","msg":"ldap auth error","ret_code":1})`, statusBadCredentials, false},
+		{`dr1003({"result":"0","msg":"Rad:Oppp error: Limit Users Err","ret_code":1})`, statusTooManySessions, false},
+		{`dr1003({"result":"0","msg":"aW51c2UsIGxvZ2luIGFnYWlu","ret_code":1})`, statusIPInUse, false},
+		{`dr1003({"result":"0","msg":"something new","ret_code":1})`, statusUnknown, false},
+	}
+	for _, tt := range tests {
+		result, err := parseLoginResponse([]byte(tt.body))
+		if err != nil {
+			t.Fatalf("parseLoginResponse(%s): %v", tt.body, err)
+		}
+		if result.Status != tt.status || result.OK() != tt.ok {
+			t.Errorf("parseLoginResponse(%s) = %s, OK=%t, want %s, OK=%t", tt.body, result.Status, result.OK(), tt.status, tt.ok)
+		}
+	}
+}
+
+func TestLoginIPInUse(t *testing.T) {
+	portal, baseURL := newFakePortal(t,
+		fakeportal.Account{ID: "08200001", Password: "a"},
+		fakeportal.Account{ID: "08200002", Password: "b"},
+	)
+	portal.AddSession("08200001", "127.0.0.1", "aabbccddeeff")
+
+	// 其他账号占用该地址时不能视为已在线
+	other := fakeLoginConfig(baseURL, "08200002", "b")
+	result, err := newEPortalAuthenticator(other).Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != statusIPInUse || result.OK() {
+		t.Errorf("login as another account = %s, want ip_in_use", result)
+	}
+
+	// 占用该地址的是规则中的账号（包括备用账号）时视为已在线
+	other.BackupAccounts = []loginAccount{{Account: "08200001", Password: "a", ISP: "cumt"}}
+	result, err = newEPortalAuthenticator(other).Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != statusAlreadyOnline {
+		t.Errorf("login with the online account as backup = %s, want already_online", result)
+	}
+}
+
+func TestBuildLoginQuery(t *testing.T) {
+	tests := []struct {
+		action, account, isp, password string
+		want                           string
+	}{
+		{"login", "08123456", "cumt", "secret",
+			"c=Portal&a=login&login_method=1&user_account=08123456%40&user_password=secret"},
+		{"login", "08123456", "cmcc", "secret",
+			"c=Portal&a=login&login_method=1&user_account=08123456%40cmcc&user_password=secret"},
+		{"login", "08123456", "telecom", "a&b#c%d+e f",
+			"c=Portal&a=login&login_method=1&user_account=08123456%40telecom&user_password=a%26b%23c%25d%2Be+f"},
+		{"logout", "08123456", "cumt", "p+w&",
+			"c=Portal&a=logout&login_method=1&user_account=08123456%40&user_password=p%2Bw%26&ac_logout=1"},
+		{"logout", "08123456", "unicom", "secret",
+			"c=Portal&a=logout&login_method=1&user_account=08123456%40unicom&user_password=secret&ac_logout=1"},
+	}
+	for _, tt := range tests {
+		got := buildLoginQuery(tt.action, tt.account, tt.isp, tt.password)
+		if got != tt.want {
+			t.Errorf("buildLoginQuery(%q, %q, %q, %q) =\n%s\nwant\n%s", tt.action, tt.account, tt.isp, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestSendLoginRequest(t *testing.T) {
+	portal, baseURL := newFakePortal(t,
+		fakeportal.Account{ID: "08200001", Password: "p&w#1+"},
+		fakeportal.Account{ID: "08200002", Password: "b", ISP: "cmcc", Arrears: true},
+	)
+
+	tests := []struct {
+		account, password, isp string
+		want                   loginStatus
+	}{
+		{"08200001", "wrong", "cumt", statusBadCredentials},
+		{"08200002", "b", "cmcc", statusQuotaExhausted},
+		{"08200009", "x", "cumt", statusBadCredentials},
+		{"08200001", "p&w#1+", "cumt", statusSuccess},
+		{"08200001", "p&w#1+", "cumt", statusAlreadyOnline},
+	}
+	for _, tt := range tests {
+		config := fakeLoginConfig(baseURL, tt.account, tt.password)
+		config.ISP = tt.isp
+		result, err := sendLoginRequest(context.Background(), config)
+		if err != nil {
+			t.Fatalf("sendLoginRequest(context.Background(), %s): %v", tt.account, err)
+		}
+		if result.Status != tt.want {
+			t.Errorf("sendLoginRequest(context.Background(), %s, %q) = %s, want %s", tt.account, tt.password, result, tt.want)
+		}
+	}
+
+	sessions := portal.Sessions()
+	if len(sessions) != 1 || sessions[0].Account != "08200001" || sessions[0].IP != "127.0.0.1" {
+		t.Errorf("sessions = %+v, want 08200001 on 127.0.0.1", sessions)
+	}
+}
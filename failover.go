@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// loginAccount 是 login 规则中的一组账号信息
+type loginAccount struct {
+	Account      string
+	Password     string
+	ISP          string
+	PasswordFile string // 备用账号从文件读取密码，读取配置时解析为 Password
+	PasswordEnc  string // 备用账号使用设备密钥加密的密码，读取配置时解析为 Password
+}
+
+// 按规则 ID 记录当前使用的账号在候选列表中的位置
+var (
+	activeAccountsLock sync.Mutex
+	activeAccounts     = make(map[string]int)
+)
+
+// parseBackupAccount 解析 账号:密码:运营商 格式的备用账号，密码中可以包含冒号
+// 密码可以写为 file:路径 或 enc:密文 以引用密码文件或加密的密码，明文密码本身以这两个前缀开头时写为 plain:密码
+func parseBackupAccount(value string) (loginAccount, error) {
+	first := strings.Index(value, ":")
+	last := strings.LastIndex(value, ":")
+	if first < 0 || first == last {
+		return loginAccount{}, fmt.Errorf("备用账号格式应为 账号:密码:运营商")
+	}
+	account := loginAccount{
+		Account: value[:first],
+		ISP:     value[last+1:],
+	}
+	if account.Account == "" || account.ISP == "" {
+		return loginAccount{}, fmt.Errorf("备用账号缺少账号或运营商")
+	}
+
+	password := value[first+1 : last]
+	switch {
+	case strings.HasPrefix(password, "file:"):
+		account.PasswordFile = strings.TrimPrefix(password, "file:")
+		if account.PasswordFile == "" {
+			return loginAccount{}, fmt.Errorf("备用账号 %s 缺少密码文件路径", account.Account)
+		}
+	case strings.HasPrefix(password, "enc:"):
+		account.PasswordEnc = strings.TrimPrefix(password, "enc:")
+		if account.PasswordEnc == "" {
+			return loginAccount{}, fmt.Errorf("备用账号 %s 缺少加密的密码", account.Account)
+		}
+	default:
+		account.Password = strings.TrimPrefix(password, "plain:")
+	}
+	return account, nil
+}
+
+// accountCandidates 返回按优先级排列的账号，主账号在前
+func (c loginConfig) accountCandidates() []loginAccount {
+	candidates := []loginAccount{{Account: c.Account, Password: c.Password, ISP: c.ISP}}
+	return append(candidates, c.BackupAccounts...)
+}
+
+// withAccount 返回使用指定账号的配置副本
+func (c loginConfig) withAccount(a loginAccount) loginConfig {
+	c.Account = a.Account
+	c.Password = a.Password
+	c.ISP = a.ISP
+	return c
+}
+
+// activeAccount 返回规则当前使用的账号及其位置
+func (c loginConfig) activeAccount() (loginAccount, int) {
+	candidates := c.accountCandidates()
+	activeAccountsLock.Lock()
+	index := activeAccounts[c.ID]
+	activeAccountsLock.Unlock()
+	if index >= len(candidates) {
+		index = 0
+	}
+	return candidates[index], index
+}
+
+// ownsAccount 判断在线账号是否为规则中的任一账号
+func (c loginConfig) ownsAccount(status *portalStatus) bool {
+	for _, candidate := range c.accountCandidates() {
+		if status.accountMatches(candidate.Account) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldFailover 判断该结果是否应切换到下一个账号：在线数超限、流量用尽或欠费
+func shouldFailover(s loginStatus) bool {
+	return s == statusTooManySessions || s == statusQuotaExhausted
+}
+
+// loginWithFailover 从当前使用的账号开始登录，被拒绝时按优先级依次尝试其他账号
+func loginWithFailover(ctx context.Context, config loginConfig) (*loginResult, error) {
+	candidates := config.accountCandidates()
+	_, start := config.activeAccount()
+
+	var result *loginResult
+	var err error
+	for i := 0; i < len(candidates); i++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		index := (start + i) % len(candidates)
+		cfg := config.withAccount(candidates[index])
+
+		auth, authErr := newAuthenticator(cfg)
+		if authErr != nil {
+			return nil, authErr
+		}
+		result, err = loginWithRetry(ctx, auth, cfg)
+		// 在线数超限时先尝试下线该账号的其他会话
+		if err == nil && result.Status == statusTooManySessions && cfg.KickOthers && kickStaleSession(ctx, cfg, auth) {
+			result, err = loginWithRetry(ctx, auth, cfg)
+		}
+		if err == nil && result.OK() {
+			activeAccountsLock.Lock()
+			activeAccounts[config.ID] = index
+			activeAccountsLock.Unlock()
+			if index != start {
+				log.Printf("[%s] 已切换到账号 %s\n", config.ID, cfg.Account)
+			}
+			return result, nil
+		}
+		if err != nil || !shouldFailover(result.Status) {
+			return result, err
+		}
+		if i < len(candidates)-1 {
+			next := candidates[(index+1)%len(candidates)]
+			log.Printf("[%s] 账号 %s 被拒绝（%s），尝试账号 %s\n", config.ID, cfg.Account, result.Status, next.Account)
+		}
+	}
+	log.Printf("[%s] 所有账号均被拒绝\n", config.ID)
+	return result, err
+}
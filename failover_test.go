@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"cumtnet/fakeportal"
+)
+
+func TestParseBackupAccount(t *testing.T) {
+	tests := []struct {
+		value string
+		want  loginAccount
+		ok    bool
+	}{
+		{"08200001:pw:cmcc", loginAccount{Account: "08200001", Password: "pw", ISP: "cmcc"}, true},
+		{"08200001:p:w:d:cumt", loginAccount{Account: "08200001", Password: "p:w:d", ISP: "cumt"}, true},
+		{"08200001::cumt", loginAccount{Account: "08200001", ISP: "cumt"}, true},
+		{"08200001:file:/etc/cumtnet/pw:cmcc", loginAccount{Account: "08200001", ISP: "cmcc", PasswordFile: "/etc/cumtnet/pw"}, true},
+		{"08200001:enc:c2VjcmV0:cmcc", loginAccount{Account: "08200001", ISP: "cmcc", PasswordEnc: "c2VjcmV0"}, true},
+		{"08200001:plain:enc:x:cumt", loginAccount{Account: "08200001", Password: "enc:x", ISP: "cumt"}, true},
+		{"08200001:file::cumt", loginAccount{}, false},
+		{"08200001:enc::cumt", loginAccount{}, false},
+		{"08200001:pw", loginAccount{}, false},
+		{":pw:cumt", loginAccount{}, false},
+		{"08200001:pw:", loginAccount{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseBackupAccount(tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseBackupAccount(%q) = %+v, %v; want %+v, ok=%v", tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLoginWithFailover(t *testing.T) {
+	portal, baseURL := newFakePortal(t,
+		fakeportal.Account{ID: "08200001", Password: "a", Arrears: true},
+		fakeportal.Account{ID: "08200002", Password: "b", ISP: "cmcc", MaxSessions: 1},
+		fakeportal.Account{ID: "08200003", Password: "c", ISP: "telecom"},
+	)
+	// 第一个备用账号已在其他终端在线，达到在线数上限
+	portal.AddSession("08200002", "10.0.0.9", "112233445566")
+
+	config := fakeLoginConfig(baseURL, "08200001", "a")
+	config.ID = "failover"
+	config.BackupAccounts = []loginAccount{
+		{Account: "08200002", Password: "b", ISP: "cmcc"},
+		{Account: "08200003", Password: "c", ISP: "telecom"},
+	}
+	t.Cleanup(func() {
+		activeAccountsLock.Lock()
+		delete(activeAccounts, config.ID)
+		activeAccountsLock.Unlock()
+	})
+
+	result, err := loginWithFailover(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != statusSuccess {
+		t.Fatalf("failover login = %s, want success", result)
+	}
+	if active, index := config.activeAccount(); index != 2 || active.Account != "08200003" {
+		t.Errorf("active account = %s (#%d), want 08200003 (#2)", active.Account, index)
+	}
+	if session := sessionOn(portal, "127.0.0.1"); session == nil || session.Account != "08200003" {
+		t.Errorf("session on 127.0.0.1 = %+v, want 08200003", session)
+	}
+}
+
+func TestLoginWithFailoverKicksStaleSession(t *testing.T) {
+	portal, baseURL := newFakePortal(t,
+		fakeportal.Account{ID: "08200001", Password: "a", MaxSessions: 1},
+		fakeportal.Account{ID: "08200002", Password: "b"},
+	)
+	portal.AddSession("08200001", "10.0.0.9", "112233445566")
+
+	config := fakeLoginConfig(baseURL, "08200001", "a")
+	config.ID = "kick"
+	config.KickOthers = true
+	config.SelfURL = baseURL + "/Self/"
+	config.BackupAccounts = []loginAccount{{Account: "08200002", Password: "b", ISP: "cumt"}}
+	t.Cleanup(func() {
+		activeAccountsLock.Lock()
+		delete(activeAccounts, config.ID)
+		activeAccountsLock.Unlock()
+	})
+
+	result, err := loginWithFailover(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != statusSuccess {
+		t.Fatalf("login after kick = %s, want success", result)
+	}
+	// 下线旧会话后仍使用主账号，而不是切换到备用账号
+	if _, index := config.activeAccount(); index != 0 {
+		t.Errorf("active account index = %d, want 0", index)
+	}
+	sessions := portal.Sessions()
+	if len(sessions) != 1 || sessions[0].Account != "08200001" || sessions[0].IP != "127.0.0.1" {
+		t.Errorf("sessions = %+v, want only 08200001 on 127.0.0.1", sessions)
+	}
+}
+
+// sessionOn 返回模拟 portal 中指定终端地址上的会话
+func sessionOn(portal *fakeportal.Server, ip string) *fakeportal.Session {
+	for _, session := range portal.Sessions() {
+		if session.IP == ip {
+			return &session
+		}
+	}
+	return nil
+}
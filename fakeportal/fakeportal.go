@@ -0,0 +1,248 @@
+// Package fakeportal 实现一个本地的 Dr.COM ePortal、深澜和锐捷 portal 模拟服务，
+// 用于在校外测试登录、注销、状态查询和自助服务下线终端的流程。
+package fakeportal
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Account 是模拟 portal 中的一个账号
+type Account struct {
+	ID          string
+	Password    string
+	ISP         string // 运营商后缀，校园网账号为空
+	MaxSessions int    // 允许同时在线的终端数，0 表示不限制
+	Arrears     bool   // 欠费或流量用尽
+}
+
+// Session 是一个在线会话
+type Session struct {
+	Account   string
+	IP        string
+	MAC       string
+	LoginTime time.Time
+}
+
+// Server 是模拟的 ePortal，实现 http.Handler
+type Server struct {
+	mu       sync.Mutex
+	accounts map[string]*Account
+	sessions map[string]*Session // 按终端 IP 索引
+	// 自助服务系统的登录会话，cookie 到账号
+	selfTokens map[string]string
+	// 深澜 get_challenge 发出的 challenge，终端 IP 到 challenge
+	srunTokens map[string]string
+	// 锐捷 pageInfo 下发的公钥，为 nil 时不要求加密密码
+	ruijieKey *rsa.PrivateKey
+	now       func() time.Time
+}
+
+// New 创建一个没有账号的模拟 portal
+func New() *Server {
+	return &Server{
+		accounts:   make(map[string]*Account),
+		sessions:   make(map[string]*Session),
+		selfTokens: make(map[string]string),
+		srunTokens: make(map[string]string),
+		now:        time.Now,
+	}
+}
+
+// AddAccount 添加或替换账号
+func (s *Server) AddAccount(a Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account := a
+	s.accounts[a.ID] = &account
+}
+
+// AddSession 直接添加一个在线会话，用于模拟其他终端已经在线
+func (s *Server) AddSession(account, ip, mac string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[ip] = &Session{Account: account, IP: ip, MAC: mac, LoginTime: s.now()}
+}
+
+// Sessions 返回按登录时间排序的在线会话
+func (s *Server) Sessions() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, *session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LoginTime.Before(sessions[j].LoginTime)
+	})
+	return sessions
+}
+
+// ServeHTTP 分发 ePortal、chkstatus、自助服务、深澜、锐捷和探测请求
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/eportal/InterFace.do":
+		s.serveRuijie(w, r)
+	case r.URL.Path == "/generate_204":
+		s.serveProbe(w, r)
+	case strings.HasPrefix(r.URL.Path, "/eportal/"):
+		s.servePortal(w, r)
+	case r.URL.Path == "/drcom/chkstatus":
+		s.serveStatus(w, r)
+	case strings.HasPrefix(r.URL.Path, "/Self/"):
+		s.serveSelf(w, r)
+	case strings.HasPrefix(r.URL.Path, "/cgi-bin/"):
+		s.serveSrun(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// clientIP 返回请求对应的终端地址，优先使用 wlan_user_ip 参数
+func clientIP(r *http.Request) string {
+	if ip := r.URL.Query().Get("wlan_user_ip"); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *Server) servePortal(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("c") != "Portal" {
+		http.NotFound(w, r)
+		return
+	}
+	switch query.Get("a") {
+	case "login":
+		writeJSONP(w, callback(r, "dr1003"), s.login(r))
+	case "logout":
+		writeJSONP(w, callback(r, "dr1004"), s.logout(r))
+	case "unbind_mac":
+		writeJSONP(w, callback(r, "dr1002"), map[string]interface{}{"result": "1", "msg": "解绑终端MAC成功！"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// login 按真实 ePortal 的返回格式处理登录
+func (s *Server) login(r *http.Request) map[string]interface{} {
+	query := r.URL.Query()
+	user := query.Get("user_account")
+	id, isp := user, ""
+	if i := strings.LastIndex(user, "@"); i >= 0 {
+		id, isp = user[:i], user[i+1:]
+	}
+	ip := clientIP(r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[id]
+	switch {
+	case !ok || account.ISP != isp:
+		return failure(1, encodeMsg("userid error1"))
+	case account.Password != query.Get("user_password"):
+		return failure(1, "ldap auth error")
+	case account.Arrears:
+		return failure(1, "Rad:Status_Err")
+	}
+	if session, ok := s.sessions[ip]; ok {
+		if session.Account == id {
+			return failure(2, "")
+		}
+		return failure(1, encodeMsg("inuse, login again"))
+	}
+	if account.MaxSessions > 0 && s.countSessions(id) >= account.MaxSessions {
+		return failure(1, "Rad:Oppp error: Limit Users Err")
+	}
+
+	mac := strings.ToLower(query.Get("wlan_user_mac"))
+	if mac == "" {
+		mac = "000000000000"
+	}
+	s.sessions[ip] = &Session{Account: id, IP: ip, MAC: mac, LoginTime: s.now()}
+	return map[string]interface{}{"result": "1", "msg": "Portal协议认证成功！"}
+}
+
+// logout 结束终端地址上的会话
+func (s *Server) logout(r *http.Request) map[string]interface{} {
+	ip := clientIP(r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[ip]; !ok {
+		return map[string]interface{}{"result": "0", "msg": "注销失败"}
+	}
+	delete(s.sessions, ip)
+	return map[string]interface{}{"result": "1", "msg": "注销成功"}
+}
+
+// serveStatus 模拟 /drcom/chkstatus
+func (s *Server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	ip := clientIP(r)
+	s.mu.Lock()
+	session, ok := s.sessions[ip]
+	var payload map[string]interface{}
+	if ok {
+		payload = map[string]interface{}{
+			"result": 1,
+			"uid":    session.Account,
+			"v46ip":  session.IP,
+			"olmac":  session.MAC,
+			"time":   int(s.now().Sub(session.LoginTime).Minutes()),
+			"flow":   0,
+			"fee":    0,
+		}
+	} else {
+		payload = map[string]interface{}{"result": 0, "ss5": ip}
+	}
+	s.mu.Unlock()
+	writeJSONP(w, callback(r, "dr1002"), payload)
+}
+
+func (s *Server) countSessions(account string) int {
+	n := 0
+	for _, session := range s.sessions {
+		if session.Account == account {
+			n++
+		}
+	}
+	return n
+}
+
+func failure(retCode int, msg string) map[string]interface{} {
+	return map[string]interface{}{"result": "0", "msg": msg, "ret_code": retCode}
+}
+
+// encodeMsg 真实 portal 的部分 msg 以 base64 编码返回
+func encodeMsg(msg string) string {
+	return base64.StdEncoding.EncodeToString([]byte(msg))
+}
+
+func callback(r *http.Request, fallback string) string {
+	if cb := r.URL.Query().Get("callback"); cb != "" {
+		return cb
+	}
+	return fallback
+}
+
+func writeJSONP(w http.ResponseWriter, callback string, payload map[string]interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	fmt.Fprintf(w, "%s(%s)", callback, data)
+}
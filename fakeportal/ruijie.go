@@ -0,0 +1,224 @@
+package fakeportal
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// EnableRuijieEncryption 让锐捷 pageInfo 要求使用 RSA 加密密码，与 security.js 的无填充 RSA 相同
+func (s *Server) EnableRuijieEncryption() error {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.ruijieKey = key
+	s.mu.Unlock()
+	return nil
+}
+
+// serveProbe 模拟被锐捷劫持的探测地址：在线时返回 204，否则返回带 queryString 的跳转页面
+func (s *Server) serveProbe(w http.ResponseWriter, r *http.Request) {
+	ip := clientIP(r)
+	s.mu.Lock()
+	_, online := s.sessions[ip]
+	s.mu.Unlock()
+	if online {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	query := url.Values{
+		"wlanuserip": {ip},
+		"wlanacname": {"fake-ac"},
+		"nasip":      {"127.0.0.1"},
+		"mac":        {"5c0a5b3c2d1e"},
+		"url":        {"http://" + r.Host + r.URL.Path},
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<script>top.self.location.href='http://%s/eportal/index.jsp?%s'</script>", r.Host, query.Encode())
+}
+
+// serveRuijie 模拟锐捷 ePortal 的 InterFace.do 接口
+func (s *Server) serveRuijie(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var reply map[string]interface{}
+	switch r.URL.Query().Get("method") {
+	case "pageInfo":
+		reply = s.ruijiePageInfo()
+	case "login":
+		reply = s.ruijieLogin(r)
+	case "logout":
+		reply = s.ruijieLogout(r)
+	case "getOnlineUserInfo":
+		reply = s.ruijieOnlineUserInfo(r)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(reply)
+}
+
+func (s *Server) ruijiePageInfo() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reply := map[string]interface{}{
+		"passwordEncrypt":   "false",
+		"publicKeyExponent": "",
+		"publicKeyModulus":  "",
+		"service":           []string{"internet"},
+		"validCodeUrl":      "",
+	}
+	if s.ruijieKey != nil {
+		reply["passwordEncrypt"] = "true"
+		reply["publicKeyExponent"] = fmt.Sprintf("%x", s.ruijieKey.E)
+		reply["publicKeyModulus"] = s.ruijieKey.N.Text(16)
+	}
+	return reply
+}
+
+// ruijieLogin 按真实 InterFace.do?method=login 的返回格式处理登录
+func (s *Server) ruijieLogin(r *http.Request) map[string]interface{} {
+	queryString, _ := url.ParseQuery(r.PostForm.Get("queryString"))
+	ip := queryString.Get("wlanuserip")
+	if ip == "" {
+		ip = clientIP(r)
+	}
+	mac := strings.ToLower(queryString.Get("mac"))
+	id := r.PostForm.Get("userId")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	password := r.PostForm.Get("password")
+	if r.PostForm.Get("passwordEncrypt") == "true" {
+		if s.ruijieKey == nil {
+			return ruijieFailure("密码加密方式不匹配")
+		}
+		decrypted, ok := ruijieDecrypt(s.ruijieKey, password)
+		if !ok || !strings.HasSuffix(decrypted, ">"+mac) {
+			return ruijieFailure("密码解密失败")
+		}
+		password = strings.TrimSuffix(decrypted, ">"+mac)
+	}
+
+	account, ok := s.accounts[id]
+	switch {
+	case !ok:
+		return ruijieFailure("用户不存在,请输入正确的用户名!")
+	case account.Password != password:
+		return ruijieFailure("密码不匹配,请输入正确的密码!")
+	case account.Arrears:
+		return ruijieFailure("您的账户已欠费,为了不影响您正常使用网络,请尽快缴费!")
+	}
+	if session, ok := s.sessions[ip]; ok {
+		if session.Account == id {
+			return ruijieFailure("你已经在线了")
+		}
+		return ruijieFailure("该终端已被其他用户认证")
+	}
+	if account.MaxSessions > 0 && s.countSessions(id) >= account.MaxSessions {
+		return ruijieFailure("用户在线数已达上限")
+	}
+	if mac == "" {
+		mac = "000000000000"
+	}
+	s.sessions[ip] = &Session{Account: id, IP: ip, MAC: mac, LoginTime: s.now()}
+	return map[string]interface{}{
+		"userIndex":         ruijieIndex(ip),
+		"result":            "success",
+		"message":           "",
+		"forwordurl":        nil,
+		"keepaliveInterval": 0,
+		"validCodeUrl":      "",
+	}
+}
+
+// ruijieSession 根据 userIndex 查找会话，userIndex 为空时使用请求方的地址，调用方需持有 s.mu
+func (s *Server) ruijieSession(r *http.Request) (*Session, bool) {
+	ip := clientIP(r)
+	if index := r.PostForm.Get("userIndex"); index != "" {
+		decoded, err := hex.DecodeString(index)
+		if err != nil {
+			return nil, false
+		}
+		ip = string(decoded)
+	}
+	session, ok := s.sessions[ip]
+	return session, ok
+}
+
+func (s *Server) ruijieLogout(r *http.Request) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.ruijieSession(r)
+	if !ok {
+		return ruijieFailure("用户已经下线")
+	}
+	delete(s.sessions, session.IP)
+	return map[string]interface{}{"result": "success", "message": "下线成功！"}
+}
+
+func (s *Server) ruijieOnlineUserInfo(r *http.Request) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.ruijieSession(r)
+	if !ok {
+		return ruijieFailure("用户已不在线")
+	}
+	return map[string]interface{}{
+		"userIndex": ruijieIndex(session.IP),
+		"result":    "success",
+		"message":   "",
+		"userName":  session.Account,
+		"userId":    session.Account,
+		"userIp":    session.IP,
+		"userMac":   session.MAC,
+		"service":   "internet",
+	}
+}
+
+// ruijieIndex 模拟的 userIndex 为终端地址的十六进制编码
+func ruijieIndex(ip string) string {
+	return hex.EncodeToString([]byte(ip))
+}
+
+func ruijieFailure(msg string) map[string]interface{} {
+	return map[string]interface{}{"userIndex": nil, "result": "fail", "message": msg, "forwordurl": nil}
+}
+
+// ruijieDecrypt 解密 security.js 生成的密文：各块解密后按小端序还原为字节，去掉补齐的 0 后反转
+func ruijieDecrypt(key *rsa.PrivateKey, encrypted string) (string, bool) {
+	chunkSize := 2 * ((key.N.BitLen()+15)/16 - 1)
+	var data []byte
+	for _, block := range strings.Fields(encrypted) {
+		c, ok := new(big.Int).SetString(block, 16)
+		if !ok {
+			return "", false
+		}
+		m := new(big.Int).Exp(c, key.D, key.N).Bytes()
+		if len(m) > chunkSize {
+			return "", false
+		}
+		chunk := make([]byte, chunkSize)
+		copy(chunk[chunkSize-len(m):], m)
+		for i := len(chunk) - 1; i >= 0; i-- {
+			data = append(data, chunk[i])
+		}
+	}
+	data = []byte(strings.TrimRight(string(data), "\x00"))
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+	return string(data), true
+}
@@ -0,0 +1,130 @@
+package fakeportal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// selfCookie 是模拟自助服务系统的会话 cookie 名
+const selfCookie = "JSESSIONID"
+
+// serveSelf 模拟 Dr.COM 自助服务系统中查询和下线在线终端的接口
+func (s *Server) serveSelf(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/Self/login/", "/Self/login":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<form action="/Self/login/verify" method="post"><input type="hidden" name="checkcode" value="1234"></form>`)
+	case "/Self/login/verify":
+		s.selfLogin(w, r)
+	case "/Self/dashboard":
+		if _, ok := s.selfAccount(r); !ok {
+			http.Redirect(w, r, "/Self/login/", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "dashboard")
+	case "/Self/dashboard/getOnlineList":
+		s.selfOnlineList(w, r)
+	case "/Self/dashboard/tooffline":
+		s.selfOffline(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) selfLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := r.PostForm.Get("account")
+
+	s.mu.Lock()
+	account, ok := s.accounts[id]
+	if !ok || account.Password != r.PostForm.Get("password") || r.PostForm.Get("checkcode") != "1234" {
+		s.mu.Unlock()
+		http.Redirect(w, r, "/Self/login/?302=LI", http.StatusFound)
+		return
+	}
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	s.selfTokens[token] = id
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: selfCookie, Value: token, Path: "/Self"})
+	http.Redirect(w, r, "/Self/dashboard", http.StatusFound)
+}
+
+// selfAccount 返回自助服务会话对应的账号
+func (s *Server) selfAccount(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(selfCookie)
+	if err != nil {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.selfTokens[cookie.Value]
+	return id, ok
+}
+
+func (s *Server) selfOnlineList(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.selfAccount(r)
+	if !ok {
+		http.Redirect(w, r, "/Self/login/", http.StatusFound)
+		return
+	}
+	type onlineSession struct {
+		SessionID string `json:"sessionId"`
+		IP        string `json:"ip"`
+		MAC       string `json:"mac"`
+		HostName  string `json:"hostName"`
+		LoginTime string `json:"loginTime"`
+		UserID    string `json:"userId"`
+	}
+	list := []onlineSession{}
+	s.mu.Lock()
+	for _, session := range s.sessions {
+		if session.Account == id {
+			list = append(list, onlineSession{
+				SessionID: session.IP,
+				IP:        session.IP,
+				MAC:       session.MAC,
+				LoginTime: session.LoginTime.Format("2006-01-02 15:04:05"),
+				UserID:    session.Account,
+			})
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].LoginTime < list[j].LoginTime })
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (s *Server) selfOffline(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.selfAccount(r)
+	if !ok {
+		http.Redirect(w, r, "/Self/login/", http.StatusFound)
+		return
+	}
+	// 模拟 portal 以终端 IP 作为 sessionid
+	ip := r.URL.Query().Get("sessionid")
+	s.mu.Lock()
+	session, ok := s.sessions[ip]
+	ok = ok && session.Account == id
+	if ok {
+		delete(s.sessions, ip)
+	}
+	s.mu.Unlock()
+
+	reply := map[string]interface{}{"success": ok}
+	if !ok {
+		reply["msg"] = "会话不存在或已下线"
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(reply)
+}
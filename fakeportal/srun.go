@@ -0,0 +1,153 @@
+package fakeportal
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// 深澜登录请求固定的 n 和 type 参数，参与 chksum 计算
+const (
+	srunN    = "200"
+	srunType = "1"
+)
+
+// serveSrun 模拟深澜 portal 的 get_challenge、srun_portal 和 rad_user_info 接口
+func (s *Server) serveSrun(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/cgi-bin/get_challenge":
+		writeJSONP(w, callback(r, "jsonp"), s.srunChallenge(r))
+	case "/cgi-bin/srun_portal":
+		switch r.URL.Query().Get("action") {
+		case "login":
+			writeJSONP(w, callback(r, "jsonp"), s.srunLogin(r))
+		case "logout":
+			writeJSONP(w, callback(r, "jsonp"), s.srunLogout(r))
+		default:
+			http.NotFound(w, r)
+		}
+	case "/cgi-bin/rad_user_info":
+		writeJSONP(w, callback(r, "jsonp"), s.srunUserInfo(r))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// srunClientIP 返回深澜请求对应的终端地址，优先使用 ip 参数
+func srunClientIP(r *http.Request) string {
+	if ip := r.URL.Query().Get("ip"); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// srunChallenge 为终端地址生成新的 challenge，登录时用于校验密码和 chksum
+func (s *Server) srunChallenge(r *http.Request) map[string]interface{} {
+	ip := srunClientIP(r)
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+
+	s.mu.Lock()
+	s.srunTokens[ip] = token
+	s.mu.Unlock()
+	return map[string]interface{}{"error": "ok", "challenge": token, "client_ip": ip}
+}
+
+// srunLogin 按深澜的返回格式处理登录
+func (s *Server) srunLogin(r *http.Request) map[string]interface{} {
+	query := r.URL.Query()
+	username := query.Get("username")
+	id, isp := username, ""
+	if i := strings.LastIndex(username, "@"); i >= 0 {
+		id, isp = username[:i], username[i+1:]
+	}
+	ip := srunClientIP(r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.srunTokens[ip]
+	if !ok {
+		return srunFailure("challenge_expire_error", "")
+	}
+	delete(s.srunTokens, ip)
+
+	account, ok := s.accounts[id]
+	if !ok || account.ISP != isp {
+		return srunFailure("login_error", "E2531: User not found.")
+	}
+	mac := hmac.New(md5.New, []byte(token))
+	mac.Write([]byte(account.Password))
+	hmd5 := hex.EncodeToString(mac.Sum(nil))
+	if query.Get("password") != "{MD5}"+hmd5 {
+		return srunFailure("login_error", "E2901: (Third party 1)bas_find_user, password is error")
+	}
+
+	var b strings.Builder
+	for _, part := range []string{username, hmd5, query.Get("ac_id"), ip, srunN, srunType, query.Get("info")} {
+		b.WriteString(token)
+		b.WriteString(part)
+	}
+	sum := sha1.Sum([]byte(b.String()))
+	if query.Get("chksum") != hex.EncodeToString(sum[:]) || !strings.HasPrefix(query.Get("info"), "{SRBX1}") {
+		return srunFailure("sign_error", "")
+	}
+
+	switch {
+	case account.Arrears:
+		return srunFailure("login_error", "E2616: Arrearage users.")
+	case s.sessions[ip] != nil:
+		return srunFailure("login_error", "E2620: You are already online.")
+	case account.MaxSessions > 0 && s.countSessions(id) >= account.MaxSessions:
+		return srunFailure("login_error", "E2532: The online_num is exceeded.")
+	}
+	s.sessions[ip] = &Session{Account: id, IP: ip, MAC: "000000000000", LoginTime: s.now()}
+	return map[string]interface{}{"error": "ok", "suc_msg": "login_ok", "client_ip": ip}
+}
+
+// srunLogout 结束终端地址上的会话
+func (s *Server) srunLogout(r *http.Request) map[string]interface{} {
+	ip := srunClientIP(r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[ip]; !ok {
+		return srunFailure("logout_error", "You are not online.")
+	}
+	delete(s.sessions, ip)
+	return map[string]interface{}{"error": "ok", "suc_msg": "logout_ok"}
+}
+
+// srunUserInfo 模拟 rad_user_info，离线时只返回终端地址
+func (s *Server) srunUserInfo(r *http.Request) map[string]interface{} {
+	ip := srunClientIP(r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[ip]
+	if !ok {
+		return map[string]interface{}{"error": "not_online_error", "client_ip": ip}
+	}
+	return map[string]interface{}{
+		"error":        "ok",
+		"user_name":    session.Account,
+		"online_ip":    session.IP,
+		"user_mac":     session.MAC,
+		"add_time":     session.LoginTime.Unix(),
+		"sum_seconds":  int(s.now().Sub(session.LoginTime).Seconds()),
+		"sum_bytes":    0,
+		"user_balance": 0,
+	}
+}
+
+func srunFailure(code, msg string) map[string]interface{} {
+	return map[string]interface{}{"error": code, "error_msg": msg}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"cumtnet/fakeportal"
+)
+
+// accountFlags 收集可重复的 -account 参数
+type accountFlags []fakeportal.Account
+
+func (a *accountFlags) String() string {
+	return fmt.Sprint(len(*a))
+}
+
+// Set 解析 账号:密码[:运营商[:最大在线数]] 格式的账号
+func (a *accountFlags) Set(value string) error {
+	parts := strings.SplitN(value, ":", 4)
+	if len(parts) < 2 {
+		return fmt.Errorf("账号格式应为 账号:密码[:运营商[:最大在线数]]")
+	}
+	account := fakeportal.Account{ID: parts[0], Password: parts[1]}
+	if len(parts) >= 3 && parts[2] != "cumt" {
+		account.ISP = parts[2]
+	}
+	if len(parts) == 4 {
+		max, err := strconv.Atoi(parts[3])
+		if err != nil {
+			return fmt.Errorf("无效的最大在线数: %v", err)
+		}
+		account.MaxSessions = max
+	}
+	*a = append(*a, account)
+	return nil
+}
+
+// runFakePortal 实现 cumtnet fake-portal 子命令，在本地启动模拟的 ePortal
+func runFakePortal(args []string) {
+	fs := flag.NewFlagSet("fake-portal", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8801", "监听地址")
+	var accounts accountFlags
+	fs.Var(&accounts, "account", "账号:密码[:运营商[:最大在线数]]，可重复指定")
+	fs.Parse(args)
+
+	server := fakeportal.New()
+	for _, account := range accounts {
+		server.AddAccount(account)
+	}
+
+	fmt.Printf("模拟 ePortal 已启动: http://%s/eportal/\n", *listen)
+	fmt.Printf("在 login 规则中设置 option portal_url 'http://%s/eportal/' 即可使用\n", *listen)
+	if err := http.ListenAndServe(*listen, server); err != nil {
+		fmt.Fprintf(os.Stderr, "模拟 ePortal 启动失败: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -2,7 +2,6 @@ module cumtnet
 
 go 1.23
 
-require (
-	github.com/fsnotify/fsnotify v1.8.0 // indirect
-	golang.org/x/sys v0.13.0 // indirect
-)
+require github.com/fsnotify/fsnotify v1.8.0
+
+require golang.org/x/sys v0.13.0 // indirect
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cumtnet/scheduler"
+)
+
+// tasks 运行所有 login、passwall 和掉线检测任务
+var tasks = scheduler.New(localClock{})
+
+// stopAllTasks 停止所有任务，返回时所有任务 goroutine 均已退出
+func stopAllTasks() {
+	for _, id := range tasks.StopAll() {
+		log.Printf("任务 [%s] 已停止", id)
+	}
+}
+
+// loginJob 按计划执行 login 规则
+type loginJob struct {
+	config   loginConfig
+	schedule scheduler.Schedule
+}
+
+func (j *loginJob) ID() string { return ruleKey("login", j.config.ID) }
+
+func (j *loginJob) Next(now time.Time) (time.Time, bool) {
+	next, ok := j.schedule.Next(now)
+	if !ok {
+		log.Printf("[%s] 无法计算下次执行时间，Login 任务结束\n", j.config.ID)
+		return next, false
+	}
+	log.Printf("[%s] Login 任务已调度: %s（%s 后）\n", j.config.ID, next.Format(statusTimeFormat), next.Sub(now).Round(time.Second))
+	recordNextRun(j.config.ID, "login", next)
+	return next, true
+}
+
+func (j *loginJob) Run(ctx context.Context) {
+	log.Printf("[%s] 正在执行Login任务...\n", j.config.ID)
+	runLoginTask(ctx, j.config)
+	log.Printf("[%s] Login 任务完成，重新计算下次执行时间\n", j.config.ID)
+}
+
+// passwallJob 按计划执行 passwall 规则
+type passwallJob struct {
+	config   passwallConfig
+	schedule scheduler.Schedule
+}
+
+func (j *passwallJob) ID() string { return ruleKey("passwall", j.config.ID) }
+
+func (j *passwallJob) Next(now time.Time) (time.Time, bool) {
+	next, ok := j.schedule.Next(now)
+	if !ok {
+		log.Printf("[%s] 无法计算下次执行时间，Passwall 任务结束\n", j.config.ID)
+		return next, false
+	}
+	log.Printf("[%s] Passwall 任务已调度: %s（%s 后）\n", j.config.ID, next.Format(statusTimeFormat), next.Sub(now).Round(time.Second))
+	recordNextRun(j.config.ID, "passwall", next)
+	return next, true
+}
+
+func (j *passwallJob) Run(ctx context.Context) {
+	log.Printf("[%s] 正在执行Passwall任务...\n", j.config.ID)
+	execPasswallCommand(ctx, j.config)
+	if ctx.Err() != nil {
+		return
+	}
+	recordPasswallRun(j.config.ID)
+	log.Printf("[%s] Passwall任务完成，重新计算下次执行时间\n", j.config.ID)
+}
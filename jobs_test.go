@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"cumtnet/fakeportal"
+	"cumtnet/scheduler"
+)
+
+func TestScheduledLoginAndLogout(t *testing.T) {
+	portal, baseURL := newFakePortal(t, fakeportal.Account{ID: "08200001", Password: "pw"})
+	clock := scheduler.NewFakeClock(time.Date(2026, 10, 16, 7, 59, 0, 0, time.UTC)) // 星期五
+	s := scheduler.New(clock)
+	t.Cleanup(func() { s.StopAll() })
+
+	login := fakeLoginConfig(baseURL, "08200001", "pw")
+	login.ID = "in"
+	workdays, _ := scheduler.ParseWeekly([]int{1, 2, 3, 4, 5}, "08:00:00")
+	logout := fakeLoginConfig(baseURL, "08200001", "pw")
+	logout.ID = "out"
+	logout.Action = "logout"
+	nightly, _ := scheduler.ParseCron("0 23 * * *")
+
+	s.Add(&loginJob{config: login, schedule: workdays})
+	s.Add(&loginJob{config: logout, schedule: nightly})
+
+	// 两个任务都进入等待后再推进时间，任务执行完并重新等待后再检查结果
+	clock.BlockUntil(2)
+	clock.Advance(time.Minute)
+	clock.BlockUntil(2)
+	if session := sessionOn(portal, "127.0.0.1"); session == nil || session.Account != "08200001" {
+		t.Fatalf("session at 08:00 = %+v, want 08200001", session)
+	}
+
+	clock.Set(time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC))
+	clock.BlockUntil(2)
+	if sessions := portal.Sessions(); len(sessions) != 0 {
+		t.Fatalf("sessions at 23:00 = %+v, want none", sessions)
+	}
+
+	// 周六 08:00 不登录
+	clock.Set(time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC))
+	clock.BlockUntil(2)
+	if sessions := portal.Sessions(); len(sessions) != 0 {
+		t.Errorf("sessions on Saturday = %+v, want none", sessions)
+	}
+}
+
+func TestStopAllCancelsHungLogin(t *testing.T) {
+	portal := fakeportal.New()
+	portal.AddAccount(fakeportal.Account{ID: "08200001", Password: "pw"})
+	// 登录请求一直挂起，直到客户端放弃；使用默认的 30 秒超时
+	hung := make(chan struct{})
+	var once sync.Once
+	server := newStallingServer(t, portal, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Query().Get("a") != "login" {
+			return false
+		}
+		once.Do(func() { close(hung) })
+		return true
+	})
+
+	clock := scheduler.NewFakeClock(time.Date(2026, 10, 16, 7, 59, 59, 0, time.UTC))
+	s := scheduler.New(clock)
+	t.Cleanup(func() { s.StopAll() })
+	t.Cleanup(func() { pruneRuleStates(map[string]bool{}) })
+
+	config := fakeLoginConfig(server.URL, "08200001", "pw")
+	config.ID = "hung"
+	config.Retries = 3
+	every, _ := scheduler.ParseCron("* * * * * *")
+	s.Add(&loginJob{config: config, schedule: every})
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+
+	select {
+	case <-hung:
+	case <-time.After(5 * time.Second):
+		t.Fatal("login request never reached the portal")
+	}
+	start := time.Now()
+	s.StopAll()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("StopAll took %s with a hung login, want it to cancel the request", elapsed)
+	}
+
+	// 被中断的登录不记录结果，也不会重试
+	ruleStatesLock.Lock()
+	state := ruleStates[ruleKey("login", config.ID)]
+	ruleStatesLock.Unlock()
+	if state != nil && state.LastRun != "" {
+		t.Errorf("state after StopAll = %+v, want no recorded run", state)
+	}
+	if sessions := portal.Sessions(); len(sessions) != 0 {
+		t.Errorf("sessions after StopAll = %+v, want none", sessions)
+	}
+}
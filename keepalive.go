@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"cumtnet/scheduler"
+)
+
+const (
+	// DefaultProbeURL 用于判断是否被 portal 劫持的探测地址，正常联网时返回 204
+	DefaultProbeURL = "http://connect.rom.miui.com/generate_204"
+	// 默认及最小的掉线检测间隔（秒）
+	defaultKeepaliveInterval = 60
+	minKeepaliveInterval     = 10
+)
+
+// linkState 表示一次探测得到的网络状态
+type linkState int
+
+const (
+	linkOnline      linkState = iota // 可以正常访问外网
+	linkIntercepted                  // 请求被 portal 劫持，需要重新认证
+	linkDown                         // 网络不可达
+)
+
+func (s linkState) String() string {
+	switch s {
+	case linkOnline:
+		return "online"
+	case linkIntercepted:
+		return "intercepted"
+	default:
+		return "down"
+	}
+}
+
+// probeLink 访问探测地址判断当前网络状态，不跟随重定向以便识别 portal 的劫持跳转
+func probeLink(ctx context.Context, client *http.Client, probeURL string) (linkState, error) {
+	resp, err := httpGet(ctx, noRedirectClient(client), probeURL)
+	if err != nil {
+		return linkDown, classifyRequestError(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	// 探测地址正常返回 204，任何其他响应（重定向或 200 的跳转页面）都说明被劫持
+	if resp.StatusCode == http.StatusNoContent {
+		return linkOnline, nil
+	}
+	return linkIntercepted, nil
+}
+
+// probeTarget 返回配置的探测地址，未配置时使用默认值
+func (c loginConfig) probeTarget() string {
+	if c.ProbeURL != "" {
+		return c.ProbeURL
+	}
+	return DefaultProbeURL
+}
+
+// probeLinkFor 使用 login 配置绑定的接口探测网络状态
+func probeLinkFor(ctx context.Context, config loginConfig, probeURL string) (linkState, error) {
+	client, _, err := portalClientFor(config)
+	if err != nil {
+		return linkDown, err
+	}
+	return probeLink(ctx, client, probeURL)
+}
+
+// uplinkRule 是同一出口上的一条定时 login 规则
+type uplinkRule struct {
+	ID       string
+	Action   string
+	Schedule scheduler.Schedule
+}
+
+// uplink 返回 login 规则作用的出口，portal 按终端地址区分会话
+func (c loginConfig) uplink() string {
+	switch {
+	case c.SourceIP != "":
+		return "ip:" + c.SourceIP
+	case c.Interface != "":
+		return "if:" + c.Interface
+	default:
+		return "default"
+	}
+}
+
+// latestUplinkRule 返回 now 之前最近一次到期的定时规则，没有时返回 nil
+func latestUplinkRule(now time.Time, rules []uplinkRule) *uplinkRule {
+	var latest *uplinkRule
+	var latestTime time.Time
+	for i := range rules {
+		prev, ok := rules[i].Schedule.Prev(now)
+		// 同一时间的规则以配置中靠后的为准
+		if !ok || (latest != nil && prev.Before(latestTime)) {
+			continue
+		}
+		latest, latestTime = &rules[i], prev
+	}
+	return latest
+}
+
+// startKeepaliveTask 为 login 配置启动掉线检测任务，rules 为同一出口上的定时规则
+func startKeepaliveTask(config loginConfig, rules []uplinkRule) {
+	interval := config.KeepaliveInterval
+	if interval <= 0 {
+		interval = defaultKeepaliveInterval
+	} else if interval < minKeepaliveInterval {
+		interval = minKeepaliveInterval
+	}
+	// 掉线检测只负责重新登录
+	config.Action = "login"
+
+	tasks.Add(&keepaliveJob{
+		config:   config,
+		interval: scheduler.Every(time.Duration(interval) * time.Second),
+		probeURL: config.probeTarget(),
+		rules:    rules,
+	})
+	log.Printf("Keepalive 任务 [%s] 已启动", config.ID)
+}
+
+// keepaliveJob 定时探测网络，在被 portal 劫持时使用同一配置重新登录
+type keepaliveJob struct {
+	config   loginConfig
+	interval scheduler.Every
+	probeURL string
+	rules    []uplinkRule
+	started  bool
+}
+
+func (j *keepaliveJob) ID() string { return ruleKey("keepalive", j.config.ID) }
+
+// Next 启动后立即检测一次，之后按间隔检测
+func (j *keepaliveJob) Next(now time.Time) (time.Time, bool) {
+	if !j.started {
+		j.started = true
+		return now, true
+	}
+	return j.interval.Next(now)
+}
+
+func (j *keepaliveJob) Run(ctx context.Context) {
+	config := j.config
+	state, err := probeLinkFor(ctx, config, j.probeURL)
+	switch state {
+	case linkIntercepted:
+		// 探测期间任务已被停止时不再使用旧配置登录
+		if ctx.Err() != nil {
+			return
+		}
+		// 该出口最近一次定时任务为注销时保持离线，直到下一次登录任务
+		if rule := latestUplinkRule(scheduler.ClockFrom(ctx).Now(), j.rules); rule != nil && rule.Action == "logout" {
+			log.Printf("[%s] 最近一次定时任务 [%s] 为注销，跳过重新登录\n", config.ID, rule.ID)
+			return
+		}
+		log.Printf("[%s] 检测到 portal 劫持，正在重新登录...\n", config.ID)
+		result, err := loginWithFailover(ctx, config)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil && !result.OK() {
+			log.Printf("[%s] 重新登录未成功: %s\n", config.ID, result.Status)
+		}
+		recordLoginResult(config.ID, result, err)
+	case linkOnline:
+		refreshUsage(ctx, config)
+	case linkDown:
+		log.Printf("[%s] 网络不可达，跳过本次检测: %v\n", config.ID, err)
+	}
+}
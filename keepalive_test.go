@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cumtnet/fakeportal"
+	"cumtnet/scheduler"
+)
+
+// newInterceptingProbe 启动一个总是返回 portal 跳转页面的探测地址，模拟掉线被劫持
+func newInterceptingProbe(t *testing.T, portalURL string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, portalURL, http.StatusFound)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/generate_204"
+}
+
+func TestLatestUplinkRule(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC) // 星期五
+	login, _ := scheduler.ParseWeekly([]int{1, 2, 3, 4, 5}, "08:00:00")
+	logout, _ := scheduler.ParseWeekly([]int{0, 1, 2, 3, 4, 5, 6}, "23:00:00")
+	rules := []uplinkRule{
+		{ID: "in", Action: "login", Schedule: login},
+		{ID: "out", Action: "logout", Schedule: logout},
+	}
+
+	if rule := latestUplinkRule(now, rules); rule == nil || rule.ID != "in" {
+		t.Errorf("latest rule at %s = %v, want in", now, rule)
+	}
+	night := time.Date(2026, 10, 16, 23, 30, 0, 0, time.UTC)
+	if rule := latestUplinkRule(night, rules); rule == nil || rule.ID != "out" {
+		t.Errorf("latest rule at %s = %v, want out", night, rule)
+	}
+	if rule := latestUplinkRule(now, nil); rule != nil {
+		t.Errorf("latest rule without rules = %v, want nil", rule)
+	}
+}
+
+func TestKeepaliveRespectsScheduledLogout(t *testing.T) {
+	portal, baseURL := newFakePortal(t, fakeportal.Account{ID: "08200001", Password: "pw"})
+	config := fakeLoginConfig(baseURL, "08200001", "pw")
+	config.ProbeURL = newInterceptingProbe(t, baseURL+"/eportal/")
+
+	// 最近一次到期的是注销规则（1 小时前），登录规则在 2 小时前
+	job := &keepaliveJob{
+		config:   config,
+		probeURL: config.ProbeURL,
+		rules: []uplinkRule{
+			{ID: "in", Action: "login", Schedule: scheduler.Every(2 * time.Hour)},
+			{ID: "out", Action: "logout", Schedule: scheduler.Every(time.Hour)},
+		},
+	}
+	job.Run(context.Background())
+	if sessions := portal.Sessions(); len(sessions) != 0 {
+		t.Fatalf("keepalive logged in after a scheduled logout: %v", sessions)
+	}
+
+	// 最近一次为登录规则时重新登录
+	job.rules[0].Schedule = scheduler.Every(time.Minute)
+	job.Run(context.Background())
+	if sessions := portal.Sessions(); len(sessions) != 1 || sessions[0].Account != "08200001" {
+		t.Fatalf("keepalive did not log in again: %v", sessions)
+	}
+}
+
+func TestKeepaliveSkippedForLogoutRules(t *testing.T) {
+	defer stopAllTasks()
+	updateTaskRunners([]loginConfig{
+		{Config: Config{ID: "out", Enabled: true}, Action: "logout", Keepalive: true},
+	}, nil)
+	if n := tasks.Running(); n != 0 {
+		t.Errorf("running tasks = %d, want no keepalive for a logout rule", n)
+	}
+}
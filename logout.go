@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+)
+
+// unboundMAC 是 ePortal 解绑 MAC 时使用的占位地址
+const unboundMAC = "000000000000"
+
+// sendLogoutRequest 注销配置中的账号在绑定地址上的会话，并确认 portal 是否真的结束了会话
+func sendLogoutRequest(ctx context.Context, config loginConfig) (*loginResult, error) {
+	client, sourceIP, err := portalClientFor(config)
+	if err != nil {
+		log.Printf("[%s] 无法确定源地址: %v\n", config.ID, err)
+		return nil, err
+	}
+
+	// 确定要注销的终端地址：优先使用绑定的源地址，否则使用 portal 记录的地址
+	userIP, userMAC := "", unboundMAC
+	if sourceIP != nil {
+		userIP = sourceIP.String()
+	}
+	if status, err := queryPortalStatus(ctx, client, config.PortalURL); err != nil {
+		log.Printf("[%s] 查询在线状态失败: %v\n", config.ID, err)
+	} else {
+		if userIP == "" {
+			userIP = status.IP
+		}
+		if status.Online && status.MAC != "" {
+			userMAC = status.MAC
+		}
+	}
+
+	terminal := url.Values{}
+	if userIP != "" {
+		terminal.Set("wlan_user_ip", userIP)
+	}
+
+	// 先解绑账号与终端 MAC 的绑定关系，避免 AC 根据无感知认证自动重新上线
+	account := portalAccount(config.Account, config.ISP)
+	unbindURL := config.PortalURL + "?c=Portal&a=unbind_mac" +
+		"&user_account=" + url.QueryEscape(account) +
+		"&wlan_user_mac=" + url.QueryEscape(userMAC)
+	if len(terminal) > 0 {
+		unbindURL += "&" + terminal.Encode()
+	}
+	if result, err := requestPortal(ctx, client, config, unbindURL); err == nil && !result.OK() {
+		log.Printf("[%s] 解绑 MAC 未成功: %s\n", config.ID, result)
+	}
+
+	logoutURL := config.PortalURL + "?" + buildLoginQuery("logout", config.Account, config.ISP, config.Password)
+	if len(terminal) > 0 {
+		logoutURL += "&" + terminal.Encode()
+	}
+	result, err := requestPortal(ctx, client, config, logoutURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// portal 的返回并不可靠，再次查询确认会话是否已结束
+	status, err := queryPortalStatus(ctx, client, config.PortalURL)
+	if err != nil {
+		log.Printf("[%s] 无法确认注销结果: %v\n", config.ID, err)
+		return result, nil
+	}
+	if status.Online && status.accountMatches(config.Account) {
+		log.Printf("[%s] portal 仍显示账号 %s 在线，注销未生效\n", config.ID, config.Account)
+		result.Status = statusUnknown
+		return result, nil
+	}
+	log.Printf("[%s] 账号 %s 的会话已结束\n", config.ID, config.Account)
+	result.Status = statusSuccess
+	return result, nil
+}
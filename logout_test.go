@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"cumtnet/fakeportal"
+)
+
+func TestSendLogoutRequest(t *testing.T) {
+	portal, baseURL := newFakePortal(t, fakeportal.Account{ID: "08200001", Password: "pw"})
+	portal.AddSession("08200001", "127.0.0.1", "aabbccddeeff")
+	portal.AddSession("08200001", "10.0.0.9", "112233445566")
+
+	config := fakeLoginConfig(baseURL, "08200001", "pw")
+	config.Action = "logout"
+	result, err := sendLogoutRequest(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != statusSuccess {
+		t.Errorf("logout = %s, want success", result)
+	}
+	// 只注销绑定地址上的会话
+	sessions := portal.Sessions()
+	if len(sessions) != 1 || sessions[0].IP != "10.0.0.9" {
+		t.Errorf("sessions after logout = %+v, want only 10.0.0.9", sessions)
+	}
+
+	// 已经离线时 portal 返回注销失败，但确认后会话确实不存在
+	result, err = sendLogoutRequest(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != statusSuccess {
+		t.Errorf("logout while offline = %s, want success", result)
+	}
+}
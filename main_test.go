@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// 运行状态写入临时目录，避免覆盖正在运行的 cumtnet 的状态文件
+	dir, err := os.MkdirTemp("", "cumtnet-test")
+	if err != nil {
+		panic(err)
+	}
+	statusFilePath = filepath.Join(dir, "status.json")
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
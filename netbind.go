@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认的 portal 请求超时时间
+const (
+	defaultConnectTimeout = 5 * time.Second
+	defaultReadTimeout    = 10 * time.Second
+	defaultRequestTimeout = 30 * time.Second
+)
+
+// httpTimeouts 是 portal 请求的各阶段超时
+type httpTimeouts struct {
+	Connect time.Duration // 建立连接
+	Read    time.Duration // 等待响应头
+	Total   time.Duration // 整个请求，包括读取响应体
+}
+
+// 按源地址缓存的 HTTP 客户端，所有 portal 请求共享，复用连接；空字符串为默认路由
+var (
+	portalClientsLock sync.Mutex
+	portalClients     = make(map[string]*http.Client)
+	portalTimeouts    = httpTimeouts{defaultConnectTimeout, defaultReadTimeout, defaultRequestTimeout}
+)
+
+// configureHTTPClients 根据全局配置设置超时时间，并丢弃已创建的客户端
+func configureHTTPClients(global globalConfig) {
+	timeouts := httpTimeouts{global.ConnectTimeout, global.ReadTimeout, global.RequestTimeout}
+	if timeouts.Connect <= 0 {
+		timeouts.Connect = defaultConnectTimeout
+	}
+	if timeouts.Read <= 0 {
+		timeouts.Read = defaultReadTimeout
+	}
+	if timeouts.Total <= 0 {
+		timeouts.Total = defaultRequestTimeout
+	}
+
+	portalClientsLock.Lock()
+	defer portalClientsLock.Unlock()
+	for _, client := range portalClients {
+		client.CloseIdleConnections()
+	}
+	portalTimeouts = timeouts
+	portalClients = make(map[string]*http.Client)
+}
+
+// timeoutError 表示 portal 请求在某个阶段超时
+type timeoutError struct {
+	Phase string // connect、read 或 total
+	Err   error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("请求超时（%s）: %v", e.Phase, e.Err)
+}
+
+func (e *timeoutError) Unwrap() error { return e.Err }
+
+// classifyRequestError 将超时错误转换为 timeoutError，其他错误原样返回
+func classifyRequestError(err error) error {
+	var netErr net.Error
+	if err == nil || !errors.As(err, &netErr) || !netErr.Timeout() {
+		return err
+	}
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return &timeoutError{Phase: "connect", Err: err}
+	case strings.Contains(err.Error(), "awaiting response headers"):
+		return &timeoutError{Phase: "read", Err: err}
+	default:
+		return &timeoutError{Phase: "total", Err: err}
+	}
+}
+
+// resolveSourceIP 根据 source_ip 或 interface 选项得到发起请求的本地地址
+// 两者都未配置时返回 nil，使用系统默认路由
+func resolveSourceIP(config loginConfig) (net.IP, error) {
+	if config.SourceIP != "" {
+		ip := net.ParseIP(config.SourceIP)
+		if ip == nil {
+			return nil, fmt.Errorf("无效的 source_ip: %s", config.SourceIP)
+		}
+		return ip, nil
+	}
+	if config.Interface == "" {
+		return nil, nil
+	}
+
+	// 先按设备名（如 eth0.2）查找，再按 OpenWrt 逻辑接口名（如 wan2）查找
+	if ip, err := interfaceIPv4(config.Interface); err == nil {
+		return ip, nil
+	}
+	ip, err := ifstatusIPv4(config.Interface)
+	if err != nil {
+		return nil, fmt.Errorf("无法获取接口 %s 的 IPv4 地址: %v", config.Interface, err)
+	}
+	return ip, nil
+}
+
+// interfaceIPv4 返回网络设备上的第一个 IPv4 地址
+func interfaceIPv4(name string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.To4(), nil
+		}
+	}
+	return nil, fmt.Errorf("接口 %s 没有 IPv4 地址", name)
+}
+
+// ifstatusIPv4 通过 OpenWrt 的 ifstatus 获取逻辑接口的 IPv4 地址
+func ifstatusIPv4(name string) (net.IP, error) {
+	output, err := exec.Command("ifstatus", name).Output()
+	if err != nil {
+		return nil, err
+	}
+	var status struct {
+		IPv4Address []struct {
+			Address string `json:"address"`
+		} `json:"ipv4-address"`
+	}
+	if err := json.Unmarshal(output, &status); err != nil {
+		return nil, err
+	}
+	for _, addr := range status.IPv4Address {
+		if ip := net.ParseIP(addr.Address); ip != nil {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("接口 %s 没有 IPv4 地址", name)
+}
+
+// portalHTTPClient 返回从指定本地地址发起连接的共享 HTTP 客户端，localIP 为 nil 时使用默认路由
+func portalHTTPClient(localIP net.IP) *http.Client {
+	portalClientsLock.Lock()
+	defer portalClientsLock.Unlock()
+
+	key := ""
+	if localIP != nil {
+		key = localIP.String()
+	}
+	if client, ok := portalClients[key]; ok {
+		return client
+	}
+
+	dialer := &net.Dialer{Timeout: portalTimeouts.Connect}
+	if localIP != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: localIP}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.ResponseHeaderTimeout = portalTimeouts.Read
+	client := &http.Client{Transport: transport, Timeout: portalTimeouts.Total}
+	portalClients[key] = client
+	return client
+}
+
+// portalClientFor 返回 login 配置对应的 HTTP 客户端及其源地址
+func portalClientFor(config loginConfig) (*http.Client, net.IP, error) {
+	sourceIP, err := resolveSourceIP(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return portalHTTPClient(sourceIP), sourceIP, nil
+}
+
+// httpGet 发送 GET 请求，ctx 取消时中止请求
+func httpGet(ctx context.Context, client *http.Client, requestURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// httpPostForm 以表单形式发送 POST 请求，ctx 取消时中止请求
+func httpPostForm(ctx context.Context, client *http.Client, requestURL string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return client.Do(req)
+}
+
+// noRedirectClient 复制客户端并禁止跟随重定向，用于识别 portal 劫持
+func noRedirectClient(client *http.Client) *http.Client {
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &c
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cumtnet/fakeportal"
+)
+
+// useShortTimeouts 让 portal 客户端使用很短的超时，测试结束后恢复默认值
+func useShortTimeouts(t *testing.T) {
+	t.Helper()
+	configureHTTPClients(globalConfig{
+		ConnectTimeout: 200 * time.Millisecond,
+		ReadTimeout:    100 * time.Millisecond,
+		RequestTimeout: 300 * time.Millisecond,
+	})
+	t.Cleanup(func() { configureHTTPClients(globalConfig{}) })
+}
+
+// newStallingServer 启动一个在 stall 返回 true 时挂起的服务，挂起的请求在客户端放弃或测试结束时返回
+func newStallingServer(t *testing.T, handler http.Handler, stall func(w http.ResponseWriter, r *http.Request) bool) *httptest.Server {
+	t.Helper()
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if stall(w, r) {
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(done) })
+	return server
+}
+
+func TestPortalRequestTimeoutPhases(t *testing.T) {
+	useShortTimeouts(t)
+	client := portalHTTPClient(net.ParseIP("127.0.0.1"))
+
+	// 不返回响应头
+	noHeaders := newStallingServer(t, http.NotFoundHandler(), func(w http.ResponseWriter, r *http.Request) bool {
+		return true
+	})
+	_, err := queryPortalStatus(context.Background(), client, noHeaders.URL+"/eportal/")
+	var timeoutErr *timeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != "read" {
+		t.Errorf("portal without headers: error = %v, want read timeout", err)
+	}
+
+	// 返回响应头后不再发送响应体
+	stalledBody := newStallingServer(t, http.NotFoundHandler(), func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("dr1002({"))
+		w.(http.Flusher).Flush()
+		return true
+	})
+	start := time.Now()
+	_, err = queryPortalStatus(context.Background(), client, stalledBody.URL+"/eportal/")
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != "total" {
+		t.Errorf("portal stalling the body: error = %v, want total timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("portal stalling the body took %s, want about 300ms", elapsed)
+	}
+}
+
+func TestPortalHTTPClientCache(t *testing.T) {
+	useShortTimeouts(t)
+	a := portalHTTPClient(net.ParseIP("127.0.0.1"))
+	if b := portalHTTPClient(net.ParseIP("127.0.0.1")); a != b {
+		t.Error("portalHTTPClient returned different clients for the same source IP")
+	}
+	if c := portalHTTPClient(net.ParseIP("127.0.0.2")); a == c {
+		t.Error("portalHTTPClient shared a client between different source IPs")
+	}
+	if d := portalHTTPClient(nil); a == d || d != portalHTTPClient(nil) {
+		t.Error("portalHTTPClient did not cache the default-route client separately")
+	}
+	// 重新配置超时后丢弃旧的客户端
+	configureHTTPClients(globalConfig{})
+	if e := portalHTTPClient(net.ParseIP("127.0.0.1")); a == e {
+		t.Error("portalHTTPClient kept the old client after configureHTTPClients")
+	}
+}
+
+// lockedBuffer 是并发安全的日志缓冲区
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLog 将标准日志写入缓冲区，测试结束后恢复
+func captureLog(t *testing.T) *lockedBuffer {
+	t.Helper()
+	buf := &lockedBuffer{}
+	log.SetOutput(buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return buf
+}
+
+func TestLoginWithRetryAfterTimeout(t *testing.T) {
+	useShortTimeouts(t)
+	portal := fakeportal.New()
+	portal.AddAccount(fakeportal.Account{ID: "08200001", Password: "pw"})
+	// 第一次登录请求挂起，之后正常响应
+	var logins atomic.Int32
+	server := newStallingServer(t, portal, func(w http.ResponseWriter, r *http.Request) bool {
+		return r.URL.Query().Get("a") == "login" && logins.Add(1) == 1
+	})
+
+	logs := captureLog(t)
+	config := fakeLoginConfig(server.URL, "08200001", "pw")
+	config.Retries = 2
+	config.RetryBackoff = 20 * time.Millisecond
+	result, err := loginWithRetry(context.Background(), newEPortalAuthenticator(config), config)
+	if err != nil || result.Status != statusSuccess {
+		t.Fatalf("loginWithRetry = %v, %v; want success", result, err)
+	}
+	if n := logins.Load(); n != 2 {
+		t.Errorf("login requests = %d, want 2", n)
+	}
+	if !strings.Contains(logs.String(), "阶段: read") {
+		t.Errorf("log does not name the timeout phase:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// portalError 是 ePortal 已知错误信息对应的类型化错误
+type portalError struct {
+	Code      string      // 错误标识，取自 portal 返回的 msg
+	Status    loginStatus // 对应的登录结果分类
+	Chinese   string      // 中文说明
+	English   string      // 英文说明
+	Retryable bool        // 稍后重试是否可能成功；为 false 时需要用户处理
+	match     []string    // 在小写的 msg 中匹配的关键字
+}
+
+func (e *portalError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", e.Code, e.Chinese, e.English)
+}
+
+// ePortal 已知的错误
+var (
+	errUserNotFound = &portalError{
+		Code: "userid error1", Status: statusBadCredentials,
+		Chinese: "账号不存在", English: "account does not exist",
+		match: []string{"userid error1", "rad:username_err", "账号不存在", "用户不存在"},
+	}
+	errWrongPassword = &portalError{
+		Code: "userid error2", Status: statusBadCredentials,
+		Chinese: "密码错误", English: "wrong password",
+		match: []string{"userid error2", "密码错误"},
+	}
+	errISPMismatch = &portalError{
+		Code: "userid error3", Status: statusBadCredentials,
+		Chinese: "账号未开通该运营商或运营商不匹配", English: "account is not bound to this ISP",
+		match: []string{"userid error3"},
+	}
+	errLDAPAuth = &portalError{
+		Code: "ldap auth error", Status: statusBadCredentials,
+		Chinese: "LDAP 认证失败，通常是密码错误", English: "LDAP authentication failed, usually a wrong password",
+		match: []string{"ldap auth error"},
+	}
+	errTooManySessions = &portalError{
+		Code: "Rad:Oppp error: Limit Users Err", Status: statusTooManySessions,
+		Chinese: "在线终端数超限，请先下线其他终端", English: "too many devices online, log out another device first",
+		match: []string{"limit users err", "在线数超限", "终端数", "在线用户数"},
+	}
+	errArrears = &portalError{
+		Code: "Rad:Status_Err", Status: statusQuotaExhausted,
+		Chinese: "账号欠费或已停机", English: "account is in arrears or suspended",
+		match: []string{"rad:status_err", "欠费", "余额不足", "费用超支"},
+	}
+	errQuotaExhausted = &portalError{
+		Code: "Rad:Flux_Err", Status: statusQuotaExhausted,
+		Chinese: "流量已用完", English: "traffic quota exhausted",
+		match: []string{"flux", "流量已用完"},
+	}
+	errAccountPaused = &portalError{
+		Code: "Rad:Pause", Status: statusBadCredentials,
+		Chinese: "账号已暂停使用", English: "account is paused",
+		match: []string{"rad:pause", "暂停"},
+	}
+	errIPInUse = &portalError{
+		Code: "inuse, login again", Status: statusIPInUse,
+		Chinese: "该终端地址已有在线会话，可能是其他账号", English: "this IP already has an online session, possibly another account",
+		match: []string{"inuse", "已经在线", "已在线"},
+	}
+	errRadiusTimeout = &portalError{
+		Code: "Rad:Time Out", Status: statusUnknown, Retryable: true,
+		Chinese: "认证服务器无响应，请稍后重试", English: "authentication server did not respond, try again later",
+		match: []string{"time out", "timeout", "超时"},
+	}
+	errACFailure = &portalError{
+		Code: "AC999", Status: statusUnknown, Retryable: true,
+		Chinese: "接入控制器认证失败，请稍后重试", English: "access controller rejected the request, try again later",
+		match: []string{"ac999", "ac认证失败"},
+	}
+)
+
+// portalErrorCatalogue 按匹配优先级排列的已知错误
+var portalErrorCatalogue = []*portalError{
+	errUserNotFound,
+	errWrongPassword,
+	errISPMismatch,
+	errLDAPAuth,
+	errTooManySessions,
+	errArrears,
+	errQuotaExhausted,
+	errAccountPaused,
+	errIPInUse,
+	errRadiusTimeout,
+	errACFailure,
+}
+
+// lookupPortalError 根据已解码的 msg 查找已知错误，未知时返回 nil
+func lookupPortalError(msg string) *portalError {
+	msg = strings.ToLower(msg)
+	if msg == "" {
+		return nil
+	}
+	for _, e := range portalErrorCatalogue {
+		for _, keyword := range e.match {
+			if strings.Contains(msg, strings.ToLower(keyword)) {
+				return e
+			}
+		}
+	}
+	return nil
+}
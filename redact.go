@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// showSecrets 为 true 时日志和控制台输出不做脱敏，由 -show-secrets 开启，仅用于调试
+var showSecrets bool
+
+// secretParamPattern 匹配请求参数中的账号和密码，如 user_password=xxx
+var secretParamPattern = regexp.MustCompile(`(?i)\b(user_password|user_account|password|username|userId|upass|DDDDD)=([^&\s"']*)`)
+
+// minRedactLength 过短的字符串容易误伤端口、日期等内容，只依赖参数名脱敏
+const minRedactLength = 6
+
+// 已知的账号和密码，按长度从长到短排列，避免先替换了其中的一部分
+var (
+	secretsLock sync.RWMutex
+	secretWords []secretWord
+)
+
+type secretWord struct {
+	plain string
+	mask  string
+}
+
+// registerSecrets 记录配置中的账号和密码，之后的日志输出中都会被遮盖
+func registerSecrets(configs []loginConfig) {
+	seen := make(map[string]bool)
+	var words []secretWord
+	add := func(plain, mask string) {
+		if len(plain) < minRedactLength || seen[plain] {
+			return
+		}
+		seen[plain] = true
+		words = append(words, secretWord{plain, mask})
+	}
+	for _, config := range configs {
+		for _, account := range config.accountCandidates() {
+			// 日志中的 URL 使用转义后的形式
+			add(account.Password, maskPassword(account.Password))
+			add(url.QueryEscape(account.Password), maskPassword(account.Password))
+			add(account.Account, maskAccount(account.Account))
+		}
+	}
+	sort.Slice(words, func(i, j int) bool { return len(words[i].plain) > len(words[j].plain) })
+
+	secretsLock.Lock()
+	secretWords = words
+	secretsLock.Unlock()
+}
+
+// redact 遮盖文本中的账号和密码
+func redact(text string) string {
+	if showSecrets {
+		return text
+	}
+	text = secretParamPattern.ReplaceAllStringFunc(text, func(param string) string {
+		name, value, _ := strings.Cut(param, "=")
+		if strings.Contains(strings.ToLower(name), "pass") {
+			return name + "=" + maskPassword(value)
+		}
+		return name + "=" + maskAccount(value)
+	})
+
+	secretsLock.RLock()
+	defer secretsLock.RUnlock()
+	for _, word := range secretWords {
+		text = replaceToken(text, word.plain, word.mask)
+	}
+	return text
+}
+
+// replaceToken 只替换作为完整单词出现的 plain，前后紧邻字母或数字时不替换，
+// 避免纯数字的密码改写了更长的数字
+func replaceToken(text, plain, mask string) string {
+	if !strings.Contains(text, plain) {
+		return text
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(text, plain)
+		if i < 0 {
+			break
+		}
+		end := i + len(plain)
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		b.WriteString(text[:i])
+		if isWordRune(before) || isWordRune(after) {
+			b.WriteString(plain)
+		} else {
+			b.WriteString(mask)
+		}
+		text = text[end:]
+	}
+	b.WriteString(text)
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// maskPassword 完全遮盖密码，不暴露长度
+func maskPassword(password string) string {
+	if password == "" || showSecrets {
+		return password
+	}
+	return "******"
+}
+
+// maskAccount 只保留账号的首尾两位，便于区分多个账号
+func maskAccount(account string) string {
+	if showSecrets || account == "" || strings.Contains(account, "*") {
+		return account
+	}
+	if len(account) <= 4 {
+		return strings.Repeat("*", len(account))
+	}
+	return account[:2] + strings.Repeat("*", len(account)-4) + account[len(account)-2:]
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	registerSecrets([]loginConfig{
+		{Config: Config{ID: "a"}, Account: "08200001", Password: "123456"},
+		{Config: Config{ID: "b"}, Account: "08200002", Password: "8080"},
+		{Config: Config{ID: "c"}, Account: "TS20001", Password: "p@ss word"},
+	})
+	t.Cleanup(func() { registerSecrets(nil) })
+
+	tests := []struct {
+		in, want string
+	}{
+		// 参数名匹配的值总是遮盖，包括过短的密码
+		{"user_account=08200002%40&user_password=8080", "user_account=08*******40&user_password=******"},
+		// 作为完整单词出现的账号和密码
+		{"账号 08200001 登录失败", "账号 08****01 登录失败"},
+		{"08200001@cmcc 已在线", "08****01@cmcc 已在线"},
+		{"密码 123456 错误", "密码 ****** 错误"},
+		{"密码 p%40ss+word 错误", "密码 ****** 错误"},
+		{"[TS20001]", "[TS***01]"},
+		// 更长的数字或单词中的片段不替换
+		{"流量 1234567 KB", "流量 1234567 KB"},
+		{"session 9123456", "session 9123456"},
+		{"id=TS20001x", "id=TS20001x"},
+		// 过短的密码不做全文替换，不会改写端口和日期
+		{"http://10.2.5.251:8080/Self", "http://10.2.5.251:8080/Self"},
+		{"2026-08-08 08:08:00", "2026-08-08 08:08:00"},
+	}
+	for _, tt := range tests {
+		if got := redact(tt.in); got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"cumtnet/scheduler"
+)
+
+const (
+	// 默认的重试退避时间及重试总时长上限
+	defaultRetryBackoff = 5 * time.Second
+	defaultRetryMax     = 5 * time.Minute
+)
+
+// retryable 判断该分类结果是否值得重试，账号密码错误、欠费等重试也无法成功
+func (s loginStatus) retryable() bool {
+	switch s {
+	case statusBadCredentials, statusQuotaExhausted, statusTooManySessions, statusIPInUse:
+		return false
+	default:
+		return true
+	}
+}
+
+// parseDurationOption 解析时长选项，既支持 Go 的时长格式（如 30s），也支持纯数字秒数
+func parseDurationOption(value string) (time.Duration, bool) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return d, true
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	return 0, false
+}
+
+// retryDelay 计算第 attempt 次重试前的等待时间：指数退避并加入随机抖动
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	delay := backoff << uint(attempt-1)
+	if delay <= 0 || delay > time.Hour {
+		delay = time.Hour
+	}
+	// 在 [delay/2, delay) 之间取随机值，避免多个规则同时重试
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// loginWithRetry 通过驱动执行登录或注销，失败且可重试时按退避策略重试，
+// 时间取自 ctx 携带的运行该任务的调度器的时钟
+func loginWithRetry(ctx context.Context, auth Authenticator, config loginConfig) (*loginResult, error) {
+	maxTotal := config.RetryMax
+	if maxTotal <= 0 {
+		maxTotal = defaultRetryMax
+	}
+	clock := scheduler.ClockFrom(ctx)
+	deadline := clock.Now().Add(maxTotal)
+	attempts := config.Retries + 1
+
+	var result *loginResult
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("[%s] 第 %d/%d 次尝试 %s\n", config.ID, attempt, attempts, config.Action)
+		result, err = runAuthAction(ctx, auth, config.Action)
+		switch {
+		case err == nil && result.OK():
+			return result, nil
+		case err == nil && !result.retryable():
+			log.Printf("[%s] 结果不可重试，放弃: %s\n", config.ID, result)
+			return result, nil
+		}
+		var timeoutErr *timeoutError
+		if errors.As(err, &timeoutErr) {
+			log.Printf("[%s] 第 %d 次尝试超时，阶段: %s\n", config.ID, attempt, timeoutErr.Phase)
+		}
+		if ctx.Err() != nil {
+			log.Printf("[%s] 任务已停止，放弃重试\n", config.ID)
+			return nil, ctx.Err()
+		}
+		if attempt == attempts {
+			break
+		}
+
+		delay := retryDelay(config.RetryBackoff, attempt)
+		if clock.Now().Add(delay).After(deadline) {
+			log.Printf("[%s] 超出最长重试时间 %s，放弃\n", config.ID, maxTotal)
+			break
+		}
+		log.Printf("[%s] 第 %d 次尝试失败，%s 后重试\n", config.ID, attempt, delay.Round(time.Millisecond))
+		if !sleepContext(ctx, clock, delay) {
+			log.Printf("[%s] 任务已停止，放弃重试\n", config.ID)
+			return nil, ctx.Err()
+		}
+	}
+	return result, err
+}
+
+// sleepContext 按 clock 等待指定时长，ctx 取消时立即返回 false
+func sleepContext(ctx context.Context, clock scheduler.Clock, d time.Duration) bool {
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C():
+		return true
+	}
+}
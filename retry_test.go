@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"cumtnet/scheduler"
+)
+
+// flakyAuth 在前 fails 次登录时返回可重试的错误，并按 ctx 携带的时钟记录每次登录的时间
+type flakyAuth struct {
+	mu    sync.Mutex
+	fails int
+	calls []time.Time
+}
+
+func (a *flakyAuth) Login(ctx context.Context) (*loginResult, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = append(a.calls, scheduler.ClockFrom(ctx).Now())
+	if len(a.calls) <= a.fails {
+		return &loginResult{Status: errRadiusTimeout.Status, Err: errRadiusTimeout}, nil
+	}
+	return &loginResult{Status: statusSuccess}, nil
+}
+
+func (a *flakyAuth) Logout(ctx context.Context) (*loginResult, error) { return a.Login(ctx) }
+
+func (a *flakyAuth) Status(ctx context.Context) (*portalStatus, error) { return &portalStatus{}, nil }
+
+func (a *flakyAuth) Calls() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.calls)
+}
+
+func (a *flakyAuth) CallTimes() []time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]time.Time(nil), a.calls...)
+}
+
+// fakeClockContext 返回携带手动推进时钟的 ctx，与调度器传给任务的 ctx 相同
+func fakeClockContext() (context.Context, *scheduler.FakeClock) {
+	clock := scheduler.NewFakeClock(time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC))
+	return scheduler.WithClock(context.Background(), clock), clock
+}
+
+type retryOutcome struct {
+	result *loginResult
+	err    error
+}
+
+func startRetry(ctx context.Context, auth Authenticator, config loginConfig) <-chan retryOutcome {
+	done := make(chan retryOutcome, 1)
+	go func() {
+		result, err := loginWithRetry(ctx, auth, config)
+		done <- retryOutcome{result, err}
+	}()
+	return done
+}
+
+func TestLoginWithRetryUsesContextClock(t *testing.T) {
+	ctx, clock := fakeClockContext()
+	auth := &flakyAuth{fails: 2}
+	config := loginConfig{Config: Config{ID: "retry"}, Action: "login", Retries: 3, RetryBackoff: 10 * time.Second}
+
+	done := startRetry(ctx, auth, config)
+	// 每次重试前等待退避定时器，最长 20 秒
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(20 * time.Second)
+	}
+	outcome := <-done
+	if outcome.err != nil || !outcome.result.OK() {
+		t.Fatalf("loginWithRetry = %v, %v; want success", outcome.result, outcome.err)
+	}
+	if calls := auth.Calls(); calls != 3 {
+		t.Errorf("login attempts = %d, want 3", calls)
+	}
+}
+
+func TestLoginWithRetryDeadline(t *testing.T) {
+	ctx, clock := fakeClockContext()
+	auth := &flakyAuth{fails: 10}
+	// 第一次退避不超过 10 秒，第二次至少 10 秒，超出 15 秒的上限
+	config := loginConfig{Config: Config{ID: "retry"}, Action: "login", Retries: 5, RetryBackoff: 10 * time.Second, RetryMax: 15 * time.Second}
+
+	done := startRetry(ctx, auth, config)
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Second)
+	outcome := <-done
+	if outcome.err != nil || outcome.result.OK() {
+		t.Fatalf("loginWithRetry = %v, %v; want the last failure", outcome.result, outcome.err)
+	}
+	if calls := auth.Calls(); calls != 2 {
+		t.Errorf("login attempts = %d, want 2", calls)
+	}
+}
+
+func TestLoginWithRetryStopsOnCancel(t *testing.T) {
+	clockCtx, clock := fakeClockContext()
+	auth := &flakyAuth{fails: 10}
+	config := loginConfig{Config: Config{ID: "retry"}, Action: "login", Retries: 5, RetryBackoff: 10 * time.Second}
+
+	ctx, cancel := context.WithCancel(clockCtx)
+	done := startRetry(ctx, auth, config)
+	clock.BlockUntil(1)
+	cancel()
+	<-done
+	if calls := auth.Calls(); calls != 1 {
+		t.Errorf("login attempts = %d, want 1", calls)
+	}
+	if n := clock.Waiters(); n != 0 {
+		t.Errorf("pending timers after cancel = %d, want 0", n)
+	}
+}
+
+func TestLoginWithRetryBackoffGaps(t *testing.T) {
+	ctx, clock := fakeClockContext()
+	auth := &flakyAuth{fails: 4}
+	backoff := 2 * time.Second
+	config := loginConfig{Config: Config{ID: "retry"}, Action: "login", Retries: 4, RetryBackoff: backoff, RetryMax: time.Hour}
+
+	// 以 100ms 为步长推进时钟，只在重试正在等待时推进，登录时间即退避定时器到期的时间
+	const step = 100 * time.Millisecond
+	done := startRetry(ctx, auth, config)
+	var outcome retryOutcome
+	for waiting := true; waiting; {
+		select {
+		case outcome = <-done:
+			waiting = false
+		default:
+			if clock.Waiters() == 1 {
+				clock.Advance(step)
+			} else {
+				runtime.Gosched()
+			}
+		}
+	}
+	if outcome.err != nil || !outcome.result.OK() {
+		t.Fatalf("loginWithRetry = %v, %v; want success", outcome.result, outcome.err)
+	}
+
+	calls := auth.CallTimes()
+	if len(calls) != 5 {
+		t.Fatalf("login attempts = %d, want 5", len(calls))
+	}
+	// 第 n 次重试前等待 [backoff*2^(n-1)/2, backoff*2^(n-1))
+	for n := 1; n < len(calls); n++ {
+		full := backoff << uint(n-1)
+		gap := calls[n].Sub(calls[n-1])
+		if gap < full/2 || gap > full+step {
+			t.Errorf("gap before retry %d = %s, want between %s and %s", n, gap, full/2, full)
+		}
+	}
+}
+
+// retryJob 在调度器中执行一次 loginWithRetry
+type retryJob struct {
+	auth   Authenticator
+	config loginConfig
+	at     time.Time
+	done   chan retryOutcome
+}
+
+func (j *retryJob) ID() string { return "retry" }
+
+func (j *retryJob) Next(now time.Time) (time.Time, bool) { return j.at, now.Before(j.at) }
+
+func (j *retryJob) Run(ctx context.Context) {
+	result, err := loginWithRetry(ctx, j.auth, j.config)
+	j.done <- retryOutcome{result, err}
+}
+
+func TestLoginWithRetryInSchedulerJob(t *testing.T) {
+	// 调度器的时钟与全局 tasks 无关，重试仍按该时钟等待
+	clock := scheduler.NewFakeClock(time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC))
+	s := scheduler.New(clock)
+	t.Cleanup(func() { s.StopAll() })
+
+	auth := &flakyAuth{fails: 1}
+	job := &retryJob{
+		auth:   auth,
+		config: loginConfig{Config: Config{ID: "retry"}, Action: "login", Retries: 1, RetryBackoff: 10 * time.Second},
+		at:     clock.Now().Add(time.Minute),
+		done:   make(chan retryOutcome, 1),
+	}
+	s.Add(job)
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Second)
+
+	outcome := <-job.done
+	if outcome.err != nil || !outcome.result.OK() {
+		t.Fatalf("loginWithRetry = %v, %v; want success", outcome.result, outcome.err)
+	}
+	calls := auth.CallTimes()
+	if len(calls) != 2 || !calls[0].Equal(job.at) || calls[1].Sub(calls[0]) != 10*time.Second {
+		t.Errorf("login times = %v, want %s and 10s later", calls, job.at)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// 按规则 ID 保存锐捷登录返回的 userIndex，注销和查询状态时需要使用
+var (
+	ruijieSessionsLock sync.Mutex
+	ruijieSessions     = make(map[string]string)
+)
+
+// ruijieAuthenticator 是锐捷 ePortal（InterFace.do）的认证驱动
+type ruijieAuthenticator struct {
+	config loginConfig
+	index  string // 本驱动登录得到的 userIndex
+}
+
+func newRuijieAuthenticator(config loginConfig) Authenticator {
+	return &ruijieAuthenticator{config: config}
+}
+
+// ruijieResponse 是 InterFace.do 接口的通用返回
+type ruijieResponse struct {
+	Result            string `json:"result"`
+	Message           string `json:"message"`
+	UserIndex         string `json:"userIndex"`
+	UserID            string `json:"userId"`
+	UserIP            string `json:"userIp"`
+	UserMAC           string `json:"userMac"`
+	PasswordEncrypt   string `json:"passwordEncrypt"`
+	PublicKeyExponent string `json:"publicKeyExponent"`
+	PublicKeyModulus  string `json:"publicKeyModulus"`
+	raw               string
+}
+
+// interfaceURL 返回 InterFace.do 指定方法的地址
+func (a *ruijieAuthenticator) interfaceURL(portalURL, method string) string {
+	return strings.TrimRight(portalURL, "/") + "/InterFace.do?method=" + method
+}
+
+// post 以表单形式调用 InterFace.do
+func (a *ruijieAuthenticator) post(ctx context.Context, client *http.Client, portalURL, method string, form url.Values) (*ruijieResponse, error) {
+	resp, err := httpPostForm(ctx, client, a.interfaceURL(portalURL, method), form)
+	if err != nil {
+		return nil, classifyRequestError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("状态码: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, classifyRequestError(err)
+	}
+	var r ruijieResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("无法解析锐捷响应: %v", err)
+	}
+	r.raw = string(body)
+	return &r, nil
+}
+
+func (a *ruijieAuthenticator) Login(ctx context.Context) (*loginResult, error) {
+	client, _, err := portalClientFor(a.config)
+	if err != nil {
+		log.Printf("[%s] 无法确定源地址: %v\n", a.config.ID, err)
+		return nil, err
+	}
+
+	// 锐捷需要从劫持跳转中获取 queryString
+	info, err := discoverPortal(ctx, client, a.config.probeTarget())
+	if err == errNotIntercepted {
+		log.Printf("[%s] 未被 portal 劫持，视为已在线\n", a.config.ID)
+		return &loginResult{Status: statusAlreadyOnline, Msg: "未被 portal 劫持"}, nil
+	}
+	if err != nil {
+		log.Printf("[%s] 获取锐捷 queryString 失败: %v\n", a.config.ID, err)
+		return nil, err
+	}
+	redirect, err := url.Parse(info.Redirect)
+	if err != nil {
+		return nil, err
+	}
+	queryString := redirect.RawQuery
+	portalURL := a.config.PortalURL
+
+	password := a.config.Password
+	encrypted := "false"
+	pageInfo, err := a.post(ctx, client, portalURL, "pageInfo", url.Values{"queryString": {queryString}})
+	if err != nil {
+		log.Printf("[%s] 获取锐捷页面信息失败，使用明文密码: %v\n", a.config.ID, err)
+	} else if pageInfo.PasswordEncrypt == "true" {
+		password, err = ruijieEncryptPassword(password, redirect.Query().Get("mac"), pageInfo.PublicKeyExponent, pageInfo.PublicKeyModulus)
+		if err != nil {
+			return nil, fmt.Errorf("加密密码失败: %v", err)
+		}
+		encrypted = "true"
+	}
+
+	r, err := a.post(ctx, client, portalURL, "login", url.Values{
+		"userId":          {a.config.Account},
+		"password":        {password},
+		"service":         {a.config.Service},
+		"queryString":     {queryString},
+		"operatorPwd":     {""},
+		"operatorUserId":  {""},
+		"validcode":       {""},
+		"passwordEncrypt": {encrypted},
+	})
+	if err != nil {
+		log.Printf("[%s] 锐捷登录请求失败: %v\n", a.config.ID, err)
+		return nil, err
+	}
+	result := ruijieResult(r)
+	if result.Status == statusSuccess && r.UserIndex != "" {
+		a.index = r.UserIndex
+		ruijieSessionsLock.Lock()
+		ruijieSessions[a.config.ID] = r.UserIndex
+		ruijieSessionsLock.Unlock()
+	}
+	if result.OK() {
+		log.Printf("[%s] 锐捷登录成功: %s\n", a.config.ID, result)
+	} else {
+		log.Printf("[%s] 锐捷登录被拒绝: %s\n", a.config.ID, result)
+	}
+	return result, nil
+}
+
+// savedIndex 返回本驱动登录得到的 userIndex，没有时使用规则之前保存的
+func (a *ruijieAuthenticator) savedIndex() string {
+	if a.index != "" {
+		return a.index
+	}
+	ruijieSessionsLock.Lock()
+	defer ruijieSessionsLock.Unlock()
+	return ruijieSessions[a.config.ID]
+}
+
+// userIndex 返回当前会话的 userIndex，没有保存时向 portal 查询
+func (a *ruijieAuthenticator) userIndex(ctx context.Context, client *http.Client) string {
+	if index := a.savedIndex(); index != "" {
+		return index
+	}
+	if r, err := a.post(ctx, client, a.config.PortalURL, "getOnlineUserInfo", url.Values{"userIndex": {""}}); err == nil {
+		return r.UserIndex
+	}
+	return ""
+}
+
+func (a *ruijieAuthenticator) Logout(ctx context.Context) (*loginResult, error) {
+	client, _, err := portalClientFor(a.config)
+	if err != nil {
+		log.Printf("[%s] 无法确定源地址: %v\n", a.config.ID, err)
+		return nil, err
+	}
+	index := a.userIndex(ctx, client)
+	if index == "" {
+		log.Printf("[%s] 没有锐捷会话，无需注销\n", a.config.ID)
+		return &loginResult{Status: statusSuccess, Msg: "没有在线会话"}, nil
+	}
+
+	r, err := a.post(ctx, client, a.config.PortalURL, "logout", url.Values{"userIndex": {index}})
+	if err != nil {
+		log.Printf("[%s] 锐捷注销请求失败: %v\n", a.config.ID, err)
+		return nil, err
+	}
+	result := ruijieResult(r)
+	if result.Status == statusSuccess {
+		a.index = ""
+		ruijieSessionsLock.Lock()
+		delete(ruijieSessions, a.config.ID)
+		ruijieSessionsLock.Unlock()
+		log.Printf("[%s] 锐捷会话已结束: %s\n", a.config.ID, result)
+	} else {
+		log.Printf("[%s] 锐捷注销未成功: %s\n", a.config.ID, result)
+	}
+	return result, nil
+}
+
+func (a *ruijieAuthenticator) Status(ctx context.Context) (*portalStatus, error) {
+	client, _, err := portalClientFor(a.config)
+	if err != nil {
+		return nil, err
+	}
+	r, err := a.post(ctx, client, a.config.PortalURL, "getOnlineUserInfo", url.Values{"userIndex": {a.savedIndex()}})
+	if err != nil {
+		return nil, err
+	}
+	return &portalStatus{
+		Online:  r.Result == "success",
+		Account: r.UserID,
+		IP:      r.UserIP,
+		MAC:     normalizeMAC(r.UserMAC),
+		Raw:     r.raw,
+	}, nil
+}
+
+// ruijieResult 将锐捷的返回转换为统一的登录结果
+func ruijieResult(r *ruijieResponse) *loginResult {
+	result := &loginResult{
+		Result: r.Result,
+		Msg:    r.Message,
+		Raw:    r.raw,
+	}
+	switch {
+	case r.Result == "success":
+		result.Status = statusSuccess
+	case containsAny(r.Message, "已经在线", "已在线"):
+		result.Status = statusAlreadyOnline
+	case containsAny(r.Message, "密码不匹配", "密码错误", "用户不存在", "账号不存在"):
+		result.Status = statusBadCredentials
+	case containsAny(r.Message, "在线数", "终端数", "已达上限"):
+		result.Status = statusTooManySessions
+	case containsAny(r.Message, "欠费", "余额不足", "流量"):
+		result.Status = statusQuotaExhausted
+	default:
+		result.Status = statusUnknown
+	}
+	return result
+}
+
+// ruijieEncryptPassword 按锐捷 security.js 的方式加密密码：
+// 将 "密码>MAC" 反转后按 chunkSize 分块，每块按小端序转换为大整数做无填充 RSA，
+// 各块结果为十六进制字符串，以空格分隔
+func ruijieEncryptPassword(password, mac, exponentHex, modulusHex string) (string, error) {
+	e, ok := new(big.Int).SetString(exponentHex, 16)
+	if !ok {
+		return "", fmt.Errorf("无效的公钥指数: %q", exponentHex)
+	}
+	n, ok := new(big.Int).SetString(modulusHex, 16)
+	if !ok || n.Sign() == 0 {
+		return "", fmt.Errorf("无效的公钥模数: %q", modulusHex)
+	}
+	// chunkSize 为模数最高的 16 位数字之前的字节数，保证每块都小于模数
+	chunkSize := 2 * ((n.BitLen()+15)/16 - 1)
+	if chunkSize <= 0 {
+		return "", fmt.Errorf("公钥模数过短: %q", modulusHex)
+	}
+
+	plain := password
+	if mac != "" {
+		plain += ">" + mac
+	}
+	data := []byte(plain)
+	reverseBytes(data)
+	if pad := len(data) % chunkSize; pad != 0 {
+		data = append(data, make([]byte, chunkSize-pad)...)
+	}
+
+	blocks := make([]string, 0, len(data)/chunkSize)
+	for i := 0; i < len(data); i += chunkSize {
+		// 小端序的块反转后即为大端序
+		chunk := append([]byte(nil), data[i:i+chunkSize]...)
+		reverseBytes(chunk)
+		c := new(big.Int).Exp(new(big.Int).SetBytes(chunk), e, n)
+
+		// biToHex 以 16 位为单位输出，长度为 4 的倍数，0 输出为 0000
+		out := hex.EncodeToString(c.Bytes())
+		if pad := len(out) % 4; pad != 0 || out == "" {
+			out = strings.Repeat("0", 4-pad) + out
+		}
+		blocks = append(blocks, out)
+	}
+	return strings.Join(blocks, " "), nil
+}
+
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"cumtnet/fakeportal"
+)
+
+// 以下向量由锐捷 security.js 的 RSAUtils.encryptedString（getKeyPair、biToHex）计算得到，
+// 输入为反转后的 "密码>MAC"
+const ruijieTestModulus = "eeeb859733b446a954a13e4c5708bea03e029725e40cfac6846f128478fd4a63d7a61aae0ed14dad88ade0ab4474c3b286fe9444b465fd82e331639e8059c8ba4fdc7c4288edbf72259595195d79233f53da2d05664b070c1e5ed580d124bc1ff92761915f9e39c9acc98b15f9353220a03c24cd9ba980a409056133d0e63d27"
+
+var ruijieVectors = []struct {
+	password, mac, exponent, modulus string
+	want                             string
+}{
+	{"secret", "5c0a5b3c2d1e", "10001", ruijieTestModulus,
+		"7acf823597b65a055a96b4f9b9fd27836fde49714414cb1d6f846746b28507916c931271c7f93fead30040192ab285dbdcb0ef8f1f1be33f1ecbe608b3dc3d0265331b4a92278e2f03e34f50e7b58d2f407c0234880510eb1191676c4e27846ba6f5648d2690be801c9bee88508822534fffcf855ec86077bda1c30bee9af318"},
+	{"p@ss w&rd#%+", "", "10001", ruijieTestModulus,
+		"ed7d0442cdb927427054ce7c7e7fff5983fbdefd3e91e45835600f7d1adf59edceb1e1c7f415571d588a6937f6d62ef34e2f9e1e5d1c92c4a7a34d60e70573c6b9fd872d5860f3efd4bbcc0fd3a12e7eb10305fced5e954775ba3a80ad82a8e5a88e90ee48163af31b6858ce0dc363e3a21268af3d6bff3021e2955293386a3c"},
+	// 结果不足 16 位时补齐到 4 位十六进制
+	{"a", "", "3", ruijieTestModulus, "000ded21"},
+	// 128 位模数每块 14 字节，超出时分为多块并以空格分隔
+	{"password123", "5c0a5b3c2d1e", "10001", "c5d8a0e1f2b3c4d5e6f708192a3b4c5d",
+		"71c08d391aad9c751a00e9a9b460fd0c 577bce5e376a702868ae3c213c8d916f"},
+}
+
+func TestRuijieEncryptPassword(t *testing.T) {
+	for _, v := range ruijieVectors {
+		got, err := ruijieEncryptPassword(v.password, v.mac, v.exponent, v.modulus)
+		if err != nil {
+			t.Fatalf("ruijieEncryptPassword(%q): %v", v.password, err)
+		}
+		if got != v.want {
+			t.Errorf("ruijieEncryptPassword(%q, %q) =\n%s\nwant\n%s", v.password, v.mac, got, v.want)
+		}
+	}
+	if _, err := ruijieEncryptPassword("pw", "", "10001", "zz"); err == nil {
+		t.Error("ruijieEncryptPassword with an invalid modulus succeeded, want error")
+	}
+}
+
+func TestRuijieResult(t *testing.T) {
+	tests := []struct {
+		body ruijieResponse
+		want loginStatus
+	}{
+		{ruijieResponse{Result: "success", UserIndex: "abc"}, statusSuccess},
+		{ruijieResponse{Result: "fail", Message: "你已经在线了"}, statusAlreadyOnline},
+		{ruijieResponse{Result: "fail", Message: "密码不匹配,请输入正确的密码!"}, statusBadCredentials},
+		{ruijieResponse{Result: "fail", Message: "用户不存在,请输入正确的用户名!"}, statusBadCredentials},
+		{ruijieResponse{Result: "fail", Message: "用户在线数已达上限"}, statusTooManySessions},
+		{ruijieResponse{Result: "fail", Message: "您的账户已欠费,为了不影响您正常使用网络,请尽快缴费!"}, statusQuotaExhausted},
+		{ruijieResponse{Result: "fail", Message: "系统繁忙"}, statusUnknown},
+	}
+	for _, tt := range tests {
+		result := ruijieResult(&tt.body)
+		if result.Status != tt.want {
+			t.Errorf("ruijieResult(%+v) = %s, want %s", tt.body, result.Status, tt.want)
+		}
+		if result.RetCode != "" {
+			t.Errorf("ruijieResult(%+v) RetCode = %q, want empty", tt.body, result.RetCode)
+		}
+	}
+}
+
+// newRuijieConfig 启动模拟锐捷 portal，返回指向它的 login 配置
+func newRuijieConfig(t *testing.T, portal *fakeportal.Server, id, account, password string) loginConfig {
+	t.Helper()
+	server := httptest.NewServer(portal)
+	t.Cleanup(server.Close)
+	t.Cleanup(func() {
+		ruijieSessionsLock.Lock()
+		delete(ruijieSessions, id)
+		ruijieSessionsLock.Unlock()
+	})
+	return loginConfig{
+		Config:     Config{ID: id},
+		PortalURL:  server.URL + "/eportal/",
+		PortalType: "ruijie",
+		Action:     "login",
+		Account:    account,
+		Password:   password,
+		Service:    "internet",
+		ProbeURL:   server.URL + "/generate_204",
+		SourceIP:   "127.0.0.1",
+	}
+}
+
+func TestRuijieLoginLogout(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		portal := fakeportal.New()
+		portal.AddAccount(fakeportal.Account{ID: "08200001", Password: "p@ss w&rd#%+"})
+		if encrypt {
+			if err := portal.EnableRuijieEncryption(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		config := newRuijieConfig(t, portal, "ruijie", "08200001", "p@ss w&rd#%+")
+		auth := newRuijieAuthenticator(config)
+
+		result, err := auth.Login(context.Background())
+		if err != nil || result.Status != statusSuccess {
+			t.Fatalf("encrypt=%v: Login() = %v, %v; want success", encrypt, result, err)
+		}
+		status, err := auth.Status(context.Background())
+		if err != nil || !status.Online || status.Account != "08200001" || status.IP != "127.0.0.1" || status.MAC != "5c0a5b3c2d1e" {
+			t.Fatalf("encrypt=%v: Status() = %v, %v; want online as 08200001", encrypt, status, err)
+		}
+		// 已在线时探测不再被劫持
+		if result, err := auth.Login(context.Background()); err != nil || result.Status != statusAlreadyOnline {
+			t.Errorf("encrypt=%v: second Login() = %v, %v; want already_online", encrypt, result, err)
+		}
+
+		result, err = auth.Logout(context.Background())
+		if err != nil || result.Status != statusSuccess {
+			t.Fatalf("encrypt=%v: Logout() = %v, %v; want success", encrypt, result, err)
+		}
+		if status, err := auth.Status(context.Background()); err != nil || status.Online {
+			t.Errorf("encrypt=%v: Status() after logout = %v, %v; want offline", encrypt, status, err)
+		}
+
+		config.Password = "wrong"
+		if result, err := newRuijieAuthenticator(config).Login(context.Background()); err != nil || result.Status != statusBadCredentials {
+			t.Errorf("encrypt=%v: Login() with wrong password = %v, %v; want bad_credentials", encrypt, result, err)
+		}
+	}
+}
+
+func TestRuijieLogoutWithoutSavedIndex(t *testing.T) {
+	portal := fakeportal.New()
+	portal.AddAccount(fakeportal.Account{ID: "08200001", Password: "pw"})
+	config := newRuijieConfig(t, portal, "ruijie-restart", "08200001", "pw")
+
+	if result, err := newRuijieAuthenticator(config).Login(context.Background()); err != nil || !result.OK() {
+		t.Fatalf("Login() = %v, %v", result, err)
+	}
+	// 模拟 cumtnet 重启后丢失了保存的 userIndex，注销时向 portal 查询
+	ruijieSessionsLock.Lock()
+	delete(ruijieSessions, config.ID)
+	ruijieSessionsLock.Unlock()
+
+	result, err := newRuijieAuthenticator(config).Logout(context.Background())
+	if err != nil || result.Status != statusSuccess {
+		t.Fatalf("Logout() = %v, %v; want success", result, err)
+	}
+	if sessions := portal.Sessions(); len(sessions) != 0 {
+		t.Errorf("sessions after logout = %+v, want none", sessions)
+	}
+}
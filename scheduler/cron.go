@@ -0,0 +1,286 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronField 是 cron 字段允许取值的位图
+type cronField uint64
+
+func (f cronField) has(v int) bool {
+	return v >= 0 && v < 64 && f&(1<<uint(v)) != 0
+}
+
+// cronNth 表示“每月第 n 个星期几”，即 dow 字段中的 weekday#n
+type cronNth struct {
+	Weekday int
+	N       int
+}
+
+// Cron 是解析后的 cron 表达式
+type Cron struct {
+	expr    string
+	seconds cronField
+	minutes cronField
+	hours   cronField
+	dom     cronField
+	months  cronField
+	dow     cronField
+	nth     []cronNth
+	// 日期和星期字段是否为 *，两者都有限制时按 Vixie cron 的规则取并集
+	domStar bool
+	dowStar bool
+}
+
+var (
+	cronMonthNames = map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}
+	cronWeekdayNames = map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}
+	// 常用的预定义表达式
+	cronMacros = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// ParseCron 解析 5 段（分 时 日 月 周）或 6 段（秒 分 时 日 月 周）的 cron 表达式
+// 支持 *、?、列表、范围、步长、月份和星期的英文缩写，以及星期字段中的 weekday#n
+func ParseCron(expr string) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron 表达式应为 5 段或 6 段: %q", expr)
+	}
+
+	s := &Cron{expr: expr}
+	var err error
+	if s.seconds, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("秒字段无效: %v", err)
+	}
+	if s.minutes, err = parseCronField(fields[1], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("分钟字段无效: %v", err)
+	}
+	if s.hours, err = parseCronField(fields[2], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("小时字段无效: %v", err)
+	}
+	if s.dom, err = parseCronField(fields[3], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("日期字段无效: %v", err)
+	}
+	if s.months, err = parseCronField(fields[4], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("月份字段无效: %v", err)
+	}
+	if s.dow, s.nth, err = parseCronWeekdays(fields[5]); err != nil {
+		return nil, fmt.Errorf("星期字段无效: %v", err)
+	}
+	s.domStar = isCronStar(fields[3])
+	s.dowStar = isCronStar(fields[5])
+	return s, nil
+}
+
+// isCronStar 判断字段是否以 * 或 ? 开头，与 Vixie cron 判断日期和星期是否受限的方式一致
+func isCronStar(field string) bool {
+	return strings.HasPrefix(field, "*") || field == "?"
+}
+
+// parseCronField 解析一个逗号分隔的字段
+func parseCronField(field string, min, max int, names map[string]int) (cronField, error) {
+	var bits cronField
+	for _, item := range strings.Split(field, ",") {
+		lo, hi, step, err := parseCronRange(item, min, max, names)
+		if err != nil {
+			return 0, err
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// parseCronRange 解析 *、a、a-b，以及带 /step 的形式
+func parseCronRange(item string, min, max int, names map[string]int) (lo, hi, step int, err error) {
+	step = 1
+	rangePart := item
+	if i := strings.Index(item, "/"); i >= 0 {
+		rangePart = item[:i]
+		step, err = strconv.Atoi(item[i+1:])
+		if err != nil || step <= 0 {
+			return 0, 0, 0, fmt.Errorf("无效的步长: %q", item)
+		}
+	}
+
+	switch {
+	case rangePart == "*" || rangePart == "?":
+		lo, hi = min, max
+	case strings.Contains(rangePart, "-"):
+		a, b, _ := strings.Cut(rangePart, "-")
+		if lo, err = parseCronValue(a, names); err != nil {
+			return 0, 0, 0, err
+		}
+		if hi, err = parseCronValue(b, names); err != nil {
+			return 0, 0, 0, err
+		}
+	default:
+		if lo, err = parseCronValue(rangePart, names); err != nil {
+			return 0, 0, 0, err
+		}
+		hi = lo
+		// a/step 表示从 a 开始直到最大值
+		if rangePart != item {
+			hi = max
+		}
+	}
+	if lo < min || hi > max || lo > hi {
+		return 0, 0, 0, fmt.Errorf("%q 超出范围 %d-%d", item, min, max)
+	}
+	return lo, hi, step, nil
+}
+
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToUpper(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("无效的值: %q", value)
+	}
+	return v, nil
+}
+
+// parseCronWeekdays 解析星期字段，7 与 0 都表示星期日
+func parseCronWeekdays(field string) (cronField, []cronNth, error) {
+	var bits cronField
+	var nth []cronNth
+	for _, item := range strings.Split(field, ",") {
+		if day, n, ok := strings.Cut(item, "#"); ok {
+			weekday, err := parseCronValue(day, cronWeekdayNames)
+			if err != nil {
+				return 0, nil, err
+			}
+			if weekday == 7 {
+				weekday = 0
+			}
+			count, err := strconv.Atoi(n)
+			if err != nil || weekday < 0 || weekday > 6 || count < 1 || count > 5 {
+				return 0, nil, fmt.Errorf("无效的 weekday#n: %q", item)
+			}
+			nth = append(nth, cronNth{Weekday: weekday, N: count})
+			continue
+		}
+		lo, hi, step, err := parseCronRange(item, 0, 7, cronWeekdayNames)
+		if err != nil {
+			return 0, nil, err
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v%7)
+		}
+	}
+	return bits, nth, nil
+}
+
+// String 返回原始表达式
+func (s *Cron) String() string {
+	return s.expr
+}
+
+// dayMatches 判断日期是否满足日期和星期字段
+func (s *Cron) dayMatches(t time.Time) bool {
+	domMatch := s.dom.has(t.Day())
+	dowMatch := s.dow.has(int(t.Weekday()))
+	for _, n := range s.nth {
+		if int(t.Weekday()) == n.Weekday && (t.Day()-1)/7+1 == n.N {
+			dowMatch = true
+		}
+	}
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// cronSearchLimit 查找执行时间的最大范围，超过时认为表达式不会触发（如 2 月 30 日）
+const cronSearchLimit = 5
+
+// Next 返回 after 之后（不含）的第一个执行时间，使用 after 所在的时区
+func (s *Cron) Next(after time.Time) (time.Time, bool) {
+	loc := after.Location()
+	t := after.Truncate(time.Second).Add(time.Second)
+	limit := t.AddDate(cronSearchLimit, 0, 0)
+
+	// 逐级跳到下一个可能匹配的月、日、时、分、秒
+	advance := func(next time.Time) {
+		// 夏令时切换时 time.Date 可能得到更早的时间，保证始终向前推进
+		if !next.After(t) {
+			next = t.Add(time.Second)
+		}
+		t = next
+	}
+	for t.Before(limit) {
+		switch {
+		case !s.months.has(int(t.Month())):
+			advance(time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+		case !s.dayMatches(t):
+			advance(time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+		case !s.hours.has(t.Hour()):
+			advance(time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc))
+		case !s.minutes.has(t.Minute()):
+			advance(time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc))
+		case !s.seconds.has(t.Second()):
+			advance(time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second()+1, 0, loc))
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Prev 返回 before 之前（不含）的最近一次执行时间，使用 before 所在的时区
+func (s *Cron) Prev(before time.Time) (time.Time, bool) {
+	loc := before.Location()
+	t := before.Add(-time.Nanosecond).Truncate(time.Second)
+	limit := t.AddDate(-cronSearchLimit, 0, 0)
+
+	// 逐级退到上一个可能匹配的月、日、时、分、秒的最后一秒
+	retreat := func(prev time.Time) {
+		if !prev.Before(t) {
+			prev = t.Add(-time.Second)
+		}
+		t = prev
+	}
+	for t.After(limit) {
+		switch {
+		case !s.months.has(int(t.Month())):
+			retreat(time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc).Add(-time.Second))
+		case !s.dayMatches(t):
+			retreat(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc).Add(-time.Second))
+		case !s.hours.has(t.Hour()):
+			retreat(time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc).Add(-time.Second))
+		case !s.minutes.has(t.Minute()):
+			retreat(time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(-time.Second))
+		case !s.seconds.has(t.Second()):
+			retreat(t.Add(-time.Second))
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,197 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func at(year int, month time.Month, day, hour, min, sec int) time.Time {
+	return time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+}
+
+// nextN 从 from 开始连续调用 Next，返回最多 n 个执行时间
+func nextN(s Schedule, from time.Time, n int) []time.Time {
+	var times []time.Time
+	for len(times) < n {
+		next, ok := s.Next(from)
+		if !ok {
+			break
+		}
+		times = append(times, next)
+		from = next
+	}
+	return times
+}
+
+func TestCronNext(t *testing.T) {
+	// 2026-10-16 为星期五
+	from := at(2026, 10, 16, 12, 0, 0)
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		{"steps and ranges", "*/30 7-22 * * 1-5", at(2026, 10, 16, 21, 45, 0), []time.Time{
+			at(2026, 10, 16, 22, 0, 0), at(2026, 10, 16, 22, 30, 0), at(2026, 10, 19, 7, 0, 0), at(2026, 10, 19, 7, 30, 0),
+		}},
+		{"list and start/step", "5,35 9/6 * * *", from, []time.Time{
+			at(2026, 10, 16, 15, 5, 0), at(2026, 10, 16, 15, 35, 0), at(2026, 10, 16, 21, 5, 0), at(2026, 10, 16, 21, 35, 0), at(2026, 10, 17, 9, 5, 0),
+		}},
+		{"month and weekday names", "0 9 * jan,JUL Mon-WED", from, []time.Time{
+			at(2027, 1, 4, 9, 0, 0), at(2027, 1, 5, 9, 0, 0), at(2027, 1, 6, 9, 0, 0), at(2027, 1, 11, 9, 0, 0),
+		}},
+		{"7 is Sunday", "0 0 * * 7", from, []time.Time{
+			at(2026, 10, 18, 0, 0, 0), at(2026, 10, 25, 0, 0, 0),
+		}},
+		{"range ending on 7", "0 0 * * 5-7", from, []time.Time{
+			at(2026, 10, 17, 0, 0, 0), at(2026, 10, 18, 0, 0, 0), at(2026, 10, 23, 0, 0, 0),
+		}},
+		{"first Monday", "0 8 * * 1#1", from, []time.Time{
+			at(2026, 11, 2, 8, 0, 0), at(2026, 12, 7, 8, 0, 0), at(2027, 1, 4, 8, 0, 0),
+		}},
+		{"fifth Friday", "0 8 * * FRI#5", from, []time.Time{
+			at(2026, 10, 30, 8, 0, 0), at(2027, 1, 29, 8, 0, 0),
+		}},
+		{"nth combined with a weekday", "0 8 * * 0,1#1", from, []time.Time{
+			at(2026, 10, 18, 8, 0, 0), at(2026, 10, 25, 8, 0, 0), at(2026, 11, 1, 8, 0, 0), at(2026, 11, 2, 8, 0, 0),
+		}},
+		// 日期和星期都有限制时取并集
+		{"dom or dow", "0 0 13 * 5", at(2026, 10, 1, 0, 0, 0), []time.Time{
+			at(2026, 10, 2, 0, 0, 0), at(2026, 10, 9, 0, 0, 0), at(2026, 10, 13, 0, 0, 0), at(2026, 10, 16, 0, 0, 0),
+		}},
+		{"dom range or dow", "0 0 1-3 * 1", at(2026, 10, 26, 0, 0, 0), []time.Time{
+			at(2026, 11, 1, 0, 0, 0), at(2026, 11, 2, 0, 0, 0), at(2026, 11, 3, 0, 0, 0), at(2026, 11, 9, 0, 0, 0),
+		}},
+		// 任一字段为 * 或 ? 时取交集，*/10 同样视为 *
+		{"dom star and dow", "0 0 * * 5", from, []time.Time{
+			at(2026, 10, 23, 0, 0, 0), at(2026, 10, 30, 0, 0, 0),
+		}},
+		{"dom and dow question mark", "0 0 13 * ?", from, []time.Time{
+			at(2026, 11, 13, 0, 0, 0), at(2026, 12, 13, 0, 0, 0),
+		}},
+		{"dom star step and dow", "0 0 */10 * 5", from, []time.Time{
+			at(2026, 12, 11, 0, 0, 0),
+		}},
+		{"six fields", "30 */20 9 * * *", at(2026, 10, 16, 9, 0, 0), []time.Time{
+			at(2026, 10, 16, 9, 0, 30), at(2026, 10, 16, 9, 20, 30), at(2026, 10, 16, 9, 40, 30), at(2026, 10, 17, 9, 0, 30),
+		}},
+		{"six fields with seconds list", "0,15 0 0 1 * ?", from, []time.Time{
+			at(2026, 11, 1, 0, 0, 0), at(2026, 11, 1, 0, 0, 15), at(2026, 12, 1, 0, 0, 0),
+		}},
+		{"@hourly", "@hourly", from, []time.Time{at(2026, 10, 16, 13, 0, 0), at(2026, 10, 16, 14, 0, 0)}},
+		{"@daily", "@daily", from, []time.Time{at(2026, 10, 17, 0, 0, 0), at(2026, 10, 18, 0, 0, 0)}},
+		{"@weekly", "@weekly", from, []time.Time{at(2026, 10, 18, 0, 0, 0), at(2026, 10, 25, 0, 0, 0)}},
+		{"@monthly", "@Monthly", from, []time.Time{at(2026, 11, 1, 0, 0, 0), at(2026, 12, 1, 0, 0, 0)}},
+		{"@yearly", " @yearly ", from, []time.Time{at(2027, 1, 1, 0, 0, 0), at(2028, 1, 1, 0, 0, 0)}},
+		{"leap day", "0 0 29 2 *", from, []time.Time{at(2028, 2, 29, 0, 0, 0), at(2032, 2, 29, 0, 0, 0)}},
+		{"31st skips short months", "0 0 31 * *", from, []time.Time{
+			at(2026, 10, 31, 0, 0, 0), at(2026, 12, 31, 0, 0, 0), at(2027, 1, 31, 0, 0, 0), at(2027, 3, 31, 0, 0, 0),
+		}},
+		// 不在整秒的起点
+		{"fractional start", "* * * * * *", from.Add(1500 * time.Millisecond), []time.Time{
+			at(2026, 10, 16, 12, 0, 2), at(2026, 10, 16, 12, 0, 3),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mustCron(t, tt.expr)
+			got := nextN(c, tt.from, len(tt.want))
+			if len(got) != len(tt.want) {
+				t.Fatalf("Next(%s) fired %v, want %v", tt.from, got, tt.want)
+			}
+			for i := range tt.want {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("firing %d = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCronNeverFires(t *testing.T) {
+	for _, expr := range []string{
+		"0 0 30 2 *",
+		"0 0 31 4,6,9,11 *",
+		"0 0 30,31 feb ?",
+	} {
+		c := mustCron(t, expr)
+		start := time.Now()
+		if next, ok := c.Next(at(2026, 10, 16, 0, 0, 0)); ok {
+			t.Errorf("%q: Next = %s, want none", expr, next)
+		}
+		if prev, ok := c.Prev(at(2026, 10, 16, 0, 0, 0)); ok {
+			t.Errorf("%q: Prev = %s, want none", expr, prev)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%q: searching took %s", expr, elapsed)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"@reboot",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"60 * * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1- * * * *",
+		"1,,2 * * * *",
+		"a * * * *",
+		"* * * FOO *",
+		"* * * * FUN",
+		"* * * * 1#0",
+		"* * * * 1#6",
+		"* * * * 8#1",
+		"* * * * 1#x",
+	} {
+		if c, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) = %v, want error", expr, c)
+		}
+	}
+}
+
+func TestCronPrevMatchesNext(t *testing.T) {
+	from := at(2026, 10, 16, 12, 0, 0)
+	for _, expr := range []string{
+		"*/30 7-22 * * 1-5",
+		"0 9 * JAN,JUL MON-WED",
+		"0 8 * * 1#1",
+		"0 0 13 * 5",
+		"0 0 */10 * 5",
+		"30 */20 9 * * *",
+		"0 0 29 2 *",
+		"0 0 31 * *",
+		"@weekly",
+	} {
+		c := mustCron(t, expr)
+		times := nextN(c, from, 6)
+		if len(times) != 6 {
+			t.Fatalf("%q fired %d times, want 6", expr, len(times))
+		}
+		for i := 1; i < len(times); i++ {
+			// 执行时间之前的上一次执行时间，以及两次之间任意时刻的上一次执行时间
+			if prev, ok := c.Prev(times[i]); !ok || !prev.Equal(times[i-1]) {
+				t.Errorf("%q: Prev(%s) = %s, %v; want %s", expr, times[i], prev, ok, times[i-1])
+			}
+			middle := times[i-1].Add(times[i].Sub(times[i-1]) / 2)
+			if prev, ok := c.Prev(middle); !ok || !prev.Equal(times[i-1]) {
+				t.Errorf("%q: Prev(%s) = %s, %v; want %s", expr, middle, prev, ok, times[i-1])
+			}
+			if prev, ok := c.Prev(times[i-1].Add(time.Nanosecond)); !ok || !prev.Equal(times[i-1]) {
+				t.Errorf("%q: Prev just after %s = %s, %v", expr, times[i-1], prev, ok)
+			}
+		}
+	}
+}
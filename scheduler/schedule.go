@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+)
+
+// Schedule 计算任务的执行时间
+type Schedule interface {
+	// Next 返回 after 之后（不含）的第一个执行时间，使用 after 所在的时区；没有时返回 false
+	Next(after time.Time) (time.Time, bool)
+	// Prev 返回 before 之前（不含）的最近一次执行时间，用于启动后补执行错过的任务
+	Prev(before time.Time) (time.Time, bool)
+}
+
+// Weekly 在指定的星期几的固定时刻执行，对应配置中的 time 和 weekdays
+type Weekly struct {
+	Weekdays []int // 0 为星期日
+	Hour     int
+	Minute   int
+	Second   int
+}
+
+// ParseWeekly 根据星期列表和 15:04:05 格式的时刻创建 Weekly
+func ParseWeekly(weekdays []int, timeOfDay string) (*Weekly, error) {
+	t, err := time.Parse("15:04:05", timeOfDay)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时间格式: %v", err)
+	}
+	w := &Weekly{Hour: t.Hour(), Minute: t.Minute(), Second: t.Second()}
+	for _, day := range weekdays {
+		if day >= 0 && day <= 6 {
+			w.Weekdays = append(w.Weekdays, day)
+		}
+	}
+	if len(w.Weekdays) == 0 {
+		return nil, fmt.Errorf("没有指定有效的星期")
+	}
+	return w, nil
+}
+
+func (w *Weekly) Next(after time.Time) (time.Time, bool) {
+	// 从今天开始逐日查找，第 7 天为下周的同一天
+	for i := 0; i <= 7; i++ {
+		day := after.AddDate(0, 0, i)
+		t := time.Date(day.Year(), day.Month(), day.Day(), w.Hour, w.Minute, w.Second, 0, after.Location())
+		if t.After(after) && w.matches(t.Weekday()) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (w *Weekly) Prev(before time.Time) (time.Time, bool) {
+	for i := 0; i <= 7; i++ {
+		day := before.AddDate(0, 0, -i)
+		t := time.Date(day.Year(), day.Month(), day.Day(), w.Hour, w.Minute, w.Second, 0, before.Location())
+		if t.Before(before) && w.matches(t.Weekday()) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (w *Weekly) matches(weekday time.Weekday) bool {
+	for _, day := range w.Weekdays {
+		if day == int(weekday) {
+			return true
+		}
+	}
+	return false
+}
+
+// Every 以固定间隔执行
+type Every time.Duration
+
+func (e Every) Next(after time.Time) (time.Time, bool) {
+	if e <= 0 {
+		return time.Time{}, false
+	}
+	return after.Add(time.Duration(e)), true
+}
+
+func (e Every) Prev(before time.Time) (time.Time, bool) {
+	if e <= 0 {
+		return time.Time{}, false
+	}
+	return before.Add(-time.Duration(e)), true
+}
@@ -0,0 +1,148 @@
+// Package scheduler 按计划运行可取消的任务，时间来源可以替换，便于测试。
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Job 是按计划执行的任务
+type Job interface {
+	// ID 唯一标识任务，添加同 ID 的任务会替换旧任务
+	ID() string
+	// Next 返回 now 之后的下次执行时间，返回 false 时任务结束
+	Next(now time.Time) (time.Time, bool)
+	// Run 执行一次任务，应在 ctx 取消后尽快返回，任务中的等待应使用 ClockFrom(ctx)
+	Run(ctx context.Context)
+}
+
+// MaxWait 等待执行时间时每次最多等待的时长，之后按时钟重新计算，
+// 以便 NTP 校时等时间跳变不会让任务在错误的时间执行
+const MaxWait = time.Minute
+
+// Scheduler 为每个 Job 运行一个 goroutine
+type Scheduler struct {
+	clock Clock
+	mu    sync.Mutex
+	jobs  map[string]*entry
+}
+
+type entry struct {
+	cancel context.CancelFunc
+	done   chan struct{} // goroutine 退出后关闭
+}
+
+// New 创建使用指定时钟的调度器，clock 为 nil 时使用系统时钟
+func New(clock Clock) *Scheduler {
+	if clock == nil {
+		clock = RealClock()
+	}
+	return &Scheduler{clock: clock, jobs: make(map[string]*entry)}
+}
+
+// Clock 返回调度器使用的时钟
+func (s *Scheduler) Clock() Clock {
+	return s.clock
+}
+
+// Add 启动任务，同 ID 的旧任务会先被停止
+func (s *Scheduler) Add(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.jobs[job.ID()]; ok {
+		old.cancel()
+		<-old.done
+	}
+	ctx, cancel := context.WithCancel(WithClock(context.Background(), s.clock))
+	e := &entry{cancel: cancel, done: make(chan struct{})}
+	s.jobs[job.ID()] = e
+	go func() {
+		defer close(e.done)
+		s.run(ctx, job)
+	}()
+}
+
+// Remove 停止任务并等待其退出
+func (s *Scheduler) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.jobs[id]
+	if !ok {
+		return false
+	}
+	e.cancel()
+	<-e.done
+	delete(s.jobs, id)
+	return true
+}
+
+// StopAll 停止所有任务，返回时所有任务 goroutine 均已退出，返回被停止的任务 ID
+func (s *Scheduler) StopAll() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 先全部取消再等待，避免逐个等待正在进行的请求
+	ids := make([]string, 0, len(s.jobs))
+	for id, e := range s.jobs {
+		e.cancel()
+		ids = append(ids, id)
+	}
+	for _, e := range s.jobs {
+		<-e.done
+	}
+	s.jobs = make(map[string]*entry)
+	return ids
+}
+
+// Running 返回仍在运行的任务数，任务的 Next 返回 false 后不再计入
+func (s *Scheduler) Running() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, e := range s.jobs {
+		select {
+		case <-e.done:
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	for {
+		next, ok := job.Next(s.clock.Now())
+		if !ok {
+			return
+		}
+		if !s.waitUntil(ctx, next) {
+			return
+		}
+		job.Run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// waitUntil 等待时钟到达 t，ctx 取消时立即返回 false
+func (s *Scheduler) waitUntil(ctx context.Context, t time.Time) bool {
+	for {
+		d := t.Sub(s.clock.Now())
+		if d <= 0 {
+			return ctx.Err() == nil
+		}
+		if d > MaxWait {
+			d = MaxWait
+		}
+		timer := s.clock.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C():
+		}
+	}
+}
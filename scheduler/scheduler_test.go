@@ -0,0 +1,277 @@
+package scheduler
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// funcJob 是测试用的任务，按 schedule 执行 run
+type funcJob struct {
+	id       string
+	schedule Schedule
+	run      func(ctx context.Context)
+}
+
+func (j *funcJob) ID() string { return j.id }
+
+func (j *funcJob) Next(now time.Time) (time.Time, bool) { return j.schedule.Next(now) }
+
+func (j *funcJob) Run(ctx context.Context) { j.run(ctx) }
+
+// once 是只执行一次的计划
+type once struct{ at time.Time }
+
+func (o once) Next(after time.Time) (time.Time, bool) { return o.at, after.Before(o.at) }
+
+func (o once) Prev(before time.Time) (time.Time, bool) { return o.at, o.at.Before(before) }
+
+// waitGoroutines 等待 goroutine 数量回落到 n 以下，返回最终的数量
+func waitGoroutines(n int) int {
+	deadline := time.Now().Add(time.Second)
+	for {
+		got := runtime.NumGoroutine()
+		if got <= n || time.Now().After(deadline) {
+			return got
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStopAllLeavesNoGoroutines(t *testing.T) {
+	base := runtime.NumGoroutine()
+	clock := NewFakeClock(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	s := New(clock)
+
+	noop := func(ctx context.Context) {}
+	s.Add(&funcJob{id: "a", schedule: Every(time.Hour), run: noop})
+	s.Add(&funcJob{id: "b", schedule: Every(time.Minute), run: noop})
+
+	// 立即执行并一直阻塞到 ctx 取消的任务
+	started := make(chan struct{})
+	s.Add(&funcJob{id: "blocked", schedule: Every(time.Second), run: func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+	}})
+	clock.BlockUntil(3)
+	clock.Advance(time.Second)
+	<-started
+
+	// 同 ID 的任务替换旧任务，不增加运行中的任务数
+	s.Add(&funcJob{id: "a", schedule: Every(2 * time.Hour), run: noop})
+	if n := s.Running(); n != 3 {
+		t.Errorf("Running() after replacing a = %d, want 3", n)
+	}
+
+	ids := s.StopAll()
+	sort.Strings(ids)
+	if len(ids) != 3 || ids[0] != "a" || ids[1] != "b" || ids[2] != "blocked" {
+		t.Errorf("StopAll() = %v, want [a b blocked]", ids)
+	}
+	if n := s.Running(); n != 0 {
+		t.Errorf("Running() after StopAll = %d, want 0", n)
+	}
+	if n := waitGoroutines(base); n > base {
+		t.Errorf("goroutines after StopAll = %d, want at most %d", n, base)
+	}
+	if n := clock.Waiters(); n != 0 {
+		t.Errorf("pending timers after StopAll = %d, want 0", n)
+	}
+
+	// 停止后可以再次添加任务
+	s.Add(&funcJob{id: "a", schedule: Every(time.Hour), run: noop})
+	if n := s.Running(); n != 1 {
+		t.Errorf("Running() after re-adding = %d, want 1", n)
+	}
+	s.StopAll()
+	if n := waitGoroutines(base); n > base {
+		t.Errorf("goroutines after second StopAll = %d, want at most %d", n, base)
+	}
+}
+
+func TestRemoveAndFinishedJobs(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	s := New(clock)
+	defer s.StopAll()
+
+	var mu sync.Mutex
+	runs := 0
+	done := make(chan struct{})
+	s.Add(&funcJob{id: "once", schedule: once{clock.Now().Add(time.Minute)}, run: func(ctx context.Context) {
+		mu.Lock()
+		runs++
+		mu.Unlock()
+		close(done)
+	}})
+	s.Add(&funcJob{id: "hourly", schedule: Every(time.Hour), run: func(ctx context.Context) {}})
+	clock.BlockUntil(2)
+	clock.Advance(time.Minute)
+	<-done
+
+	// 执行完后 Next 返回 false 的任务不再计入
+	deadline := time.Now().Add(time.Second)
+	for s.Running() != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := s.Running(); n != 1 {
+		t.Errorf("Running() after the one-shot job finished = %d, want 1", n)
+	}
+	if !s.Remove("hourly") {
+		t.Error("Remove(hourly) = false, want true")
+	}
+	if s.Remove("hourly") {
+		t.Error("second Remove(hourly) = true, want false")
+	}
+	if n := s.Running(); n != 0 {
+		t.Errorf("Running() after Remove = %d, want 0", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if runs != 1 {
+		t.Errorf("one-shot job ran %d times, want 1", runs)
+	}
+}
+
+func TestJobContextCarriesClock(t *testing.T) {
+	if _, ok := ClockFrom(context.Background()).(realClock); !ok {
+		t.Error("ClockFrom without a clock is not the real clock")
+	}
+
+	clock := NewFakeClock(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	s := New(clock)
+	defer s.StopAll()
+	got := make(chan Clock, 1)
+	s.Add(&funcJob{id: "clock", schedule: once{clock.Now().Add(time.Minute)}, run: func(ctx context.Context) {
+		got <- ClockFrom(ctx)
+	}})
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	if c := <-got; c != Clock(clock) {
+		t.Errorf("ClockFrom(job ctx) = %v, want the scheduler's clock", c)
+	}
+}
+
+// recorder 记录各任务执行时时钟的时间
+type recorder struct {
+	mu    sync.Mutex
+	clock Clock
+	fired map[string][]time.Time
+}
+
+func (r *recorder) job(id string, schedule Schedule) Job {
+	return &funcJob{id: id, schedule: schedule, run: func(ctx context.Context) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.fired[id] = append(r.fired[id], r.clock.Now())
+	}}
+}
+
+func (r *recorder) take(id string) []time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fired := r.fired[id]
+	delete(r.fired, id)
+	return fired
+}
+
+// advanceTo 以 30 秒为步长推进时钟到 end，每步等待 jobs 个任务重新进入等待
+func advanceTo(clock *FakeClock, end time.Time, jobs int) {
+	for clock.Now().Before(end) {
+		clock.Advance(30 * time.Second)
+		clock.BlockUntil(jobs)
+	}
+}
+
+func checkFired(t *testing.T, r *recorder, id string, want ...time.Time) {
+	t.Helper()
+	got := r.take(id)
+	if len(got) != len(want) {
+		t.Errorf("%s fired at %v, want %v", id, got, want)
+		return
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("%s fired at %v, want %v", id, got, want)
+			return
+		}
+	}
+}
+
+func mustCron(t *testing.T, expr string) *Cron {
+	t.Helper()
+	c, err := ParseCron(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func mustWeekly(t *testing.T, weekdays []int, timeOfDay string) *Weekly {
+	t.Helper()
+	w, err := ParseWeekly(weekdays, timeOfDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func date(day, hour, min, sec int) time.Time {
+	return time.Date(2026, 10, day, hour, min, sec, 0, time.UTC)
+}
+
+func TestSchedulesAcrossMidnightAndWeek(t *testing.T) {
+	// 2026-10-17 为星期六
+	clock := NewFakeClock(date(17, 23, 0, 0))
+	r := &recorder{clock: clock, fired: make(map[string][]time.Time)}
+	s := New(clock)
+	defer s.StopAll()
+
+	s.Add(r.job("weekly", mustWeekly(t, []int{0, 1}, "23:59:30")))
+	s.Add(r.job("sunday", mustCron(t, "0 0 * * 0")))
+	s.Add(r.job("saturday", mustCron(t, "30 59 23 * * 6")))
+	clock.BlockUntil(3)
+
+	advanceTo(clock, date(26, 0, 0, 30), 3)
+	checkFired(t, r, "weekly", date(18, 23, 59, 30), date(19, 23, 59, 30), date(25, 23, 59, 30))
+	checkFired(t, r, "sunday", date(18, 0, 0, 0), date(25, 0, 0, 0))
+	checkFired(t, r, "saturday", date(17, 23, 59, 30), date(24, 23, 59, 30))
+}
+
+func TestSchedulesAfterClockJumps(t *testing.T) {
+	// 2026-10-19 为星期一
+	clock := NewFakeClock(date(19, 7, 59, 0))
+	r := &recorder{clock: clock, fired: make(map[string][]time.Time)}
+	s := New(clock)
+	defer s.StopAll()
+
+	s.Add(r.job("weekly", mustWeekly(t, []int{1, 2, 3, 4, 5}, "08:00:00")))
+	s.Add(r.job("cron", mustCron(t, "0 8 * * 1-5")))
+	clock.BlockUntil(2)
+
+	advanceTo(clock, date(19, 8, 0, 30), 2)
+	checkFired(t, r, "weekly", date(19, 8, 0, 0))
+	checkFired(t, r, "cron", date(19, 8, 0, 0))
+
+	// 时间回拨到 07:30 后再次经过 08:00，同一天不应重复执行
+	clock.Set(date(19, 7, 30, 0))
+	clock.BlockUntil(2)
+	advanceTo(clock, date(19, 9, 0, 0), 2)
+	checkFired(t, r, "weekly")
+	checkFired(t, r, "cron")
+
+	advanceTo(clock, date(20, 8, 0, 30), 2)
+	checkFired(t, r, "weekly", date(20, 8, 0, 0))
+	checkFired(t, r, "cron", date(20, 8, 0, 0))
+
+	// 时间向前跳过多次执行时只补执行一次，然后按计划继续
+	clock.Set(date(22, 9, 0, 0))
+	clock.BlockUntil(2)
+	checkFired(t, r, "weekly", date(22, 9, 0, 0))
+	checkFired(t, r, "cron", date(22, 9, 0, 0))
+	advanceTo(clock, date(23, 8, 0, 30), 2)
+	checkFired(t, r, "weekly", date(23, 8, 0, 0))
+	checkFired(t, r, "cron", date(23, 8, 0, 0))
+}
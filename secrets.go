@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSecretKeyPath 设备本地密钥，由 cumtnet encrypt-password 首次运行时生成
+const DefaultSecretKeyPath = "/etc/cumtnet/secret.key"
+
+// secretKeySize 为 AES-256 密钥长度
+const secretKeySize = 32
+
+// loadSecretKey 读取设备密钥，密钥文件不存在时返回错误
+// 解密时不能生成新密钥：新密钥无法解开已有的密文，只会掩盖密钥丢失
+func loadSecretKey(path string) ([]byte, error) {
+	if path == "" {
+		path = DefaultSecretKeyPath
+	}
+	key, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("密钥文件 %s 不存在，密文需要由 cumtnet encrypt-password 重新生成", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != secretKeySize {
+		return nil, fmt.Errorf("密钥文件 %s 长度无效", path)
+	}
+	return key, nil
+}
+
+// loadOrCreateSecretKey 读取设备密钥，不存在时生成一个新的仅 root 可读的密钥，仅供 encrypt-password 使用
+func loadOrCreateSecretKey(path string) ([]byte, error) {
+	if path == "" {
+		path = DefaultSecretKeyPath
+	}
+	if _, err := os.Stat(path); err == nil || !errors.Is(err, os.ErrNotExist) {
+		return loadSecretKey(path)
+	}
+
+	key := make([]byte, secretKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	// O_EXCL 避免覆盖同时生成的密钥
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return loadSecretKey(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(key); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	log.Printf("已生成设备密钥 %s\n", path)
+	return key, nil
+}
+
+// encryptSecret 使用 AES-GCM 加密，返回 base64 编码的 nonce+密文
+func encryptSecret(key []byte, plaintext string) (string, error) {
+	gcm, err := newSecretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret 解密 encryptSecret 的输出
+func decryptSecret(key []byte, encoded string) (string, error) {
+	gcm, err := newSecretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("无效的密文: %v", err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("密文过短")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("解密失败，密文可能由其他设备的密钥生成")
+	}
+	return string(plain), nil
+}
+
+func newSecretCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readPasswordFile 读取密码文件的第一行，拒绝同组或其他用户可以访问的文件
+func readPasswordFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return "", fmt.Errorf("密码文件 %s 的权限为 %s，应只允许 root 读取（chmod 600）", path, perm)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	password, _, _ := strings.Cut(string(data), "\n")
+	password = strings.TrimRight(password, "\r")
+	if password == "" {
+		return "", fmt.Errorf("密码文件 %s 为空", path)
+	}
+	return password, nil
+}
+
+// resolvePassword 根据 password_file 或 password_enc 得到明文密码，两者都未配置时使用 password，
+// 同时解析备用账号中引用的密码
+func (c *loginConfig) resolvePassword(keyPath string) error {
+	switch {
+	case c.PasswordFile != "" && c.PasswordEnc != "":
+		return fmt.Errorf("password_file 和 password_enc 不能同时配置")
+	case c.PasswordFile != "":
+		password, err := readPasswordFile(c.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("无法读取 password_file: %v", err)
+		}
+		c.Password = password
+	case c.PasswordEnc != "":
+		password, err := decryptPassword(keyPath, c.PasswordEnc)
+		if err != nil {
+			return fmt.Errorf("无法解密 password_enc: %v", err)
+		}
+		c.Password = password
+	}
+
+	for i := range c.BackupAccounts {
+		if err := c.BackupAccounts[i].resolvePassword(keyPath); err != nil {
+			return fmt.Errorf("备用账号 %s %v", c.BackupAccounts[i].Account, err)
+		}
+	}
+	return nil
+}
+
+// resolvePassword 将备用账号 file: 或 enc: 形式的密码解析为明文
+func (a *loginAccount) resolvePassword(keyPath string) error {
+	switch {
+	case a.PasswordFile != "":
+		password, err := readPasswordFile(a.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("无法读取密码文件: %v", err)
+		}
+		a.Password = password
+	case a.PasswordEnc != "":
+		password, err := decryptPassword(keyPath, a.PasswordEnc)
+		if err != nil {
+			return fmt.Errorf("无法解密密码: %v", err)
+		}
+		a.Password = password
+	}
+	return nil
+}
+
+// decryptPassword 使用设备密钥解密 cumtnet encrypt-password 生成的密文
+func decryptPassword(keyPath, encrypted string) (string, error) {
+	key, err := loadSecretKey(keyPath)
+	if err != nil {
+		return "", fmt.Errorf("无法读取设备密钥: %v", err)
+	}
+	return decryptSecret(key, encrypted)
+}
+
+// runEncryptPassword 实现 cumtnet encrypt-password 子命令，输出可直接粘贴到配置中的 password_enc
+func runEncryptPassword(args []string) {
+	fs := flag.NewFlagSet("encrypt-password", flag.ExitOnError)
+	keyPath := fs.String("key", DefaultSecretKeyPath, "设备密钥文件")
+	fs.Parse(args)
+
+	// 优先从参数读取，否则从标准输入读取，避免密码留在 shell 历史中
+	password := fs.Arg(0)
+	if password == "" {
+		fmt.Fprint(os.Stderr, "请输入密码: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintf(os.Stderr, "无法读取密码: %v\n", err)
+			os.Exit(1)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		fmt.Fprintln(os.Stderr, "密码不能为空")
+		os.Exit(1)
+	}
+
+	key, err := loadOrCreateSecretKey(*keyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无法读取设备密钥: %v\n", err)
+		os.Exit(1)
+	}
+	encrypted, err := encryptSecret(key, password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "加密失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("option password_enc '%s'\n", encrypted)
+}
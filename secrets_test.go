@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadConfigBackupPasswords(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "secret.key")
+	key, err := loadOrCreateSecretKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encryptSecret(key, "enc:pw:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwordFile := filepath.Join(dir, "backup.pw")
+	if err := os.WriteFile(passwordFile, []byte("file pw 2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(dir, "cumt_login")
+	config := fmt.Sprintf(`config cumt_login
+	option secret_key '%s'
+
+config login 'work'
+	option enable '1'
+	option action 'login'
+	option account '08200001'
+	option password 'pw1'
+	option isp 'cumt'
+	option weekdays '1'
+	option time '08:15:00'
+	list backup_account '08200002:file:%s:cmcc'
+	list backup_account '08200003:enc:%s:telecom'
+	list backup_account '08200004:plain:file:pw:4:cumt'
+	list backup_account '08200005:pw:5:unicom'
+`, keyPath, passwordFile, encrypted)
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, logins, _, err := ReadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logins) != 1 {
+		t.Fatalf("got %d login rules, want 1", len(logins))
+	}
+	want := []loginAccount{
+		{Account: "08200001", Password: "pw1", ISP: "cumt"},
+		{Account: "08200002", Password: "file pw 2", ISP: "cmcc"},
+		{Account: "08200003", Password: "enc:pw:3", ISP: "telecom"},
+		{Account: "08200004", Password: "file:pw:4", ISP: "cumt"},
+		{Account: "08200005", Password: "pw:5", ISP: "unicom"},
+	}
+	got := logins[0].accountCandidates()
+	if len(got) != len(want) {
+		t.Fatalf("got %d candidates, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Account != want[i].Account || got[i].Password != want[i].Password || got[i].ISP != want[i].ISP {
+			t.Errorf("candidate %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// 无法解析的密码引用在读取配置时报错
+	broken := fmt.Sprintf("%s\tlist backup_account '08200006:file:%s:cumt'\n", config, filepath.Join(dir, "missing"))
+	if err := os.WriteFile(configPath, []byte(broken), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := ReadConfig(configPath); err == nil {
+		t.Error("ReadConfig with a missing backup password file succeeded, want error")
+	}
+}
+
+func TestReadPasswordFilePermissions(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		perm    os.FileMode
+		wantErr bool
+	}{
+		{0600, false},
+		{0400, false},
+		{0640, true},
+		{0604, true},
+		{0644, true},
+		{0660, true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("pw-%o", tt.perm))
+		if err := os.WriteFile(path, []byte("secret\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		// 避开 umask
+		if err := os.Chmod(path, tt.perm); err != nil {
+			t.Fatal(err)
+		}
+		password, err := readPasswordFile(path)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("readPasswordFile with mode %o = %q, want error", tt.perm, password)
+			}
+			continue
+		}
+		if err != nil || password != "secret" {
+			t.Errorf("readPasswordFile with mode %o = %q, %v; want secret", tt.perm, password, err)
+		}
+	}
+}
+
+func TestDecryptPasswordMissingKey(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "secret.key")
+	if _, err := decryptPassword(keyPath, "AAAA"); err == nil || !strings.Contains(err.Error(), "不存在") {
+		t.Errorf("decryptPassword without a key file: error = %v, want key file missing", err)
+	}
+	if _, err := os.Stat(keyPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("decryptPassword created the key file: stat error = %v", err)
+	}
+
+	// encrypt-password 生成的密钥之后可用于解密，再次调用不会替换密钥
+	key, err := loadOrCreateSecretKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encryptSecret(key, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := loadOrCreateSecretKey(keyPath); err != nil || !bytes.Equal(again, key) {
+		t.Errorf("loadOrCreateSecretKey replaced the existing key (err = %v)", err)
+	}
+	if password, err := decryptPassword(keyPath, encrypted); err != nil || password != "pw" {
+		t.Errorf("decryptPassword = %q, %v; want pw", password, err)
+	}
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("key file mode = %v, want 0600", perm)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// selfSession 是自助服务系统中的一个在线会话
+type selfSession struct {
+	SessionID string `json:"sessionId"`
+	IP        string `json:"ip"`
+	MAC       string `json:"mac"`
+	HostName  string `json:"hostName"`
+	LoginTime string `json:"loginTime"`
+}
+
+func (s selfSession) String() string {
+	return fmt.Sprintf("%s (mac=%s, host=%s, login=%s)", s.IP, s.MAC, s.HostName, s.LoginTime)
+}
+
+// sessionKicker 由能够下线账号其他会话的 portal 驱动实现
+type sessionKicker interface {
+	KickStaleSession(ctx context.Context) (*selfSession, error)
+}
+
+// checkcodePattern 匹配自助服务登录页中的 checkcode
+var checkcodePattern = regexp.MustCompile(`name="checkcode"\s+value="([^"]*)"`)
+
+// selfServiceURL 返回 Dr.COM 自助服务系统地址，未配置时使用 portal 主机的 8080 端口
+func (c loginConfig) selfServiceURL() (string, error) {
+	if c.SelfURL != "" {
+		return strings.TrimRight(c.SelfURL, "/"), nil
+	}
+	u, err := url.Parse(c.PortalURL)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s://%s:8080/Self", u.Scheme, u.Hostname()), nil
+}
+
+// selfServiceLogin 登录自助服务系统，返回带有会话 cookie 的客户端
+func selfServiceLogin(ctx context.Context, base *http.Client, selfURL, account, password string) (*http.Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	client := *base
+	client.Jar = jar
+
+	resp, err := httpGet(ctx, &client, selfURL+"/login/")
+	if err != nil {
+		return nil, classifyRequestError(err)
+	}
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, classifyRequestError(err)
+	}
+	checkcode := ""
+	if m := checkcodePattern.FindSubmatch(page); m != nil {
+		checkcode = string(m[1])
+	}
+
+	resp, err = httpPostForm(ctx, &client, selfURL+"/login/verify", url.Values{
+		"account":   {account},
+		"password":  {password},
+		"checkcode": {checkcode},
+		"code":      {""},
+	})
+	if err != nil {
+		return nil, classifyRequestError(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	// 登录成功后会跳转到 dashboard
+	if !strings.Contains(resp.Request.URL.Path, "dashboard") {
+		return nil, fmt.Errorf("自助服务登录失败，当前页面: %s", resp.Request.URL.Path)
+	}
+	return &client, nil
+}
+
+// selfServiceSessions 列出账号的在线会话
+func selfServiceSessions(ctx context.Context, client *http.Client, selfURL string) ([]selfSession, error) {
+	resp, err := httpGet(ctx, client, selfURL+"/dashboard/getOnlineList")
+	if err != nil {
+		return nil, classifyRequestError(err)
+	}
+	defer resp.Body.Close()
+	var sessions []selfSession
+	if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+		return nil, fmt.Errorf("无法解析在线列表: %v", err)
+	}
+	return sessions, nil
+}
+
+// pickStaleSession 选出要下线的会话：登录最早的非本路由器会话，只剩本路由器的会话时返回 nil
+func pickStaleSession(sessions []selfSession, routerIP string) *selfSession {
+	if len(sessions) == 0 {
+		return nil
+	}
+	sorted := append([]selfSession(nil), sessions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ti, _ := time.ParseInLocation(statusTimeFormat, sorted[i].LoginTime, currentZone())
+		tj, _ := time.ParseInLocation(statusTimeFormat, sorted[j].LoginTime, currentZone())
+		return ti.Before(tj)
+	})
+	for i := range sorted {
+		if sorted[i].IP != routerIP {
+			return &sorted[i]
+		}
+	}
+	return nil
+}
+
+// KickStaleSession 通过自助服务系统下线账号的一个其他会话，为路由器腾出名额
+func (a *ePortalAuthenticator) KickStaleSession(ctx context.Context) (*selfSession, error) {
+	selfURL, err := a.config.selfServiceURL()
+	if err != nil {
+		return nil, err
+	}
+	base, sourceIP, err := portalClientFor(a.config)
+	if err != nil {
+		return nil, err
+	}
+	routerIP := ""
+	if sourceIP != nil {
+		routerIP = sourceIP.String()
+	} else if status, err := a.Status(ctx); err == nil {
+		routerIP = status.IP
+	}
+
+	client, err := selfServiceLogin(ctx, base, selfURL, a.config.Account, a.config.Password)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := selfServiceSessions(ctx, client, selfURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		log.Printf("[%s] 在线会话: %s\n", a.config.ID, session)
+	}
+	target := pickStaleSession(sessions, routerIP)
+	if target == nil {
+		return nil, fmt.Errorf("账号 %s 没有可下线的会话", a.config.Account)
+	}
+
+	resp, err := httpGet(ctx, client, selfURL+"/dashboard/tooffline?sessionid="+url.QueryEscape(target.SessionID))
+	if err != nil {
+		return nil, classifyRequestError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下线会话失败，状态码: %d", resp.StatusCode)
+	}
+	// 自助服务系统在下线失败时同样返回 200，需要检查 success 字段
+	var reply struct {
+		Success bool   `json:"success"`
+		Msg     string `json:"msg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("无法解析下线结果: %v", err)
+	}
+	if !reply.Success {
+		return nil, fmt.Errorf("下线会话 %s 失败: %s", target, reply.Msg)
+	}
+	return target, nil
+}
+
+// kickStaleSession 在线数超限时通过驱动下线账号的一个其他会话，成功时返回 true
+func kickStaleSession(ctx context.Context, config loginConfig, auth Authenticator) bool {
+	kicker, ok := auth.(sessionKicker)
+	if !ok {
+		log.Printf("[%s] portal_type %s 不支持下线其他会话\n", config.ID, config.PortalType)
+		return false
+	}
+	kicked, err := kicker.KickStaleSession(ctx)
+	if err != nil {
+		log.Printf("[%s] 下线其他会话失败: %v\n", config.ID, err)
+		return false
+	}
+	log.Printf("[%s] 已下线账号 %s 的会话: %s\n", config.ID, config.Account, kicked)
+	updateRuleState(config.ID, "login", func(state *ruleState) {
+		state.LastKicked = fmt.Sprintf("%s %s %s", localNow().Format(statusTimeFormat), maskAccount(config.Account), kicked)
+	})
+	return true
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"cumtnet/fakeportal"
+)
+
+func TestPickStaleSession(t *testing.T) {
+	router := selfSession{SessionID: "1", IP: "10.0.0.1", LoginTime: "2026-10-16 07:00:00"}
+	phone := selfSession{SessionID: "2", IP: "10.0.0.2", LoginTime: "2026-10-16 09:00:00"}
+	laptop := selfSession{SessionID: "3", IP: "10.0.0.3", LoginTime: "2026-10-16 08:00:00"}
+
+	tests := []struct {
+		name     string
+		sessions []selfSession
+		want     string // 期望的 SessionID，空表示 nil
+	}{
+		{"empty", nil, ""},
+		{"only router", []selfSession{router}, ""},
+		{"router twice", []selfSession{router, router}, ""},
+		{"oldest other", []selfSession{phone, router, laptop}, "3"},
+		{"single other", []selfSession{router, phone}, "2"},
+	}
+	for _, tt := range tests {
+		got := pickStaleSession(tt.sessions, router.IP)
+		switch {
+		case tt.want == "" && got != nil:
+			t.Errorf("%s: pickStaleSession = %s, want nil", tt.name, got)
+		case tt.want != "" && (got == nil || got.SessionID != tt.want):
+			t.Errorf("%s: pickStaleSession = %v, want session %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKickStaleSession(t *testing.T) {
+	portal := fakeportal.New()
+	portal.AddAccount(fakeportal.Account{ID: "08200001", Password: "pw", MaxSessions: 2})
+	var rejectOffline atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 模拟自助服务系统以 200 返回下线失败
+		if rejectOffline.Load() && r.URL.Path == "/Self/dashboard/tooffline" {
+			w.Write([]byte(`{"success":false,"msg":"下线失败"}`))
+			return
+		}
+		portal.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	config := fakeLoginConfig(server.URL, "08200001", "pw")
+	config.SelfURL = server.URL + "/Self/"
+	auth := &ePortalAuthenticator{config: config}
+
+	// 只有路由器自己的会话时不下线
+	portal.AddSession("08200001", "127.0.0.1", "aabbccddeeff")
+	if kicked, err := auth.KickStaleSession(context.Background()); err == nil {
+		t.Fatalf("KickStaleSession with only the router online = %s, want error", kicked)
+	}
+	if len(portal.Sessions()) != 1 {
+		t.Fatalf("router session was kicked: %+v", portal.Sessions())
+	}
+
+	portal.AddSession("08200001", "10.0.0.9", "112233445566")
+	rejectOffline.Store(true)
+	if _, err := auth.KickStaleSession(context.Background()); err == nil || !strings.Contains(err.Error(), "下线失败") {
+		t.Errorf("KickStaleSession with success:false = %v, want error", err)
+	}
+
+	rejectOffline.Store(false)
+	kicked, err := auth.KickStaleSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kicked.IP != "10.0.0.9" {
+		t.Errorf("kicked %s, want 10.0.0.9", kicked)
+	}
+	if sessions := portal.Sessions(); len(sessions) != 1 || sessions[0].IP != "127.0.0.1" {
+		t.Errorf("sessions after kick = %+v, want only 127.0.0.1", sessions)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 深澜默认的 ac_id
+	defaultSrunACID = "1"
+	// 深澜登录请求固定的 n 和 type 参数
+	srunN    = "200"
+	srunType = "1"
+	// srunEncVer 是 info 中声明的加密版本
+	srunEncVer = "srun_bx1"
+)
+
+// srunBase64 是深澜使用的自定义 base64 字母表
+var srunBase64 = base64.NewEncoding("LVoJPiCN2R8G90yg+hmFHuacZ1OWMnrsSTXkYpUq/3dlbfKwv6xztjI7DeBE45QA")
+
+// srunAuthenticator 是深澜（Srun）portal 的认证驱动
+type srunAuthenticator struct {
+	config loginConfig
+}
+
+func newSrunAuthenticator(config loginConfig) Authenticator {
+	return &srunAuthenticator{config: config}
+}
+
+// username 返回提交给深澜的用户名，运营商账号带有 @运营商 后缀
+func (a *srunAuthenticator) username() string {
+	if a.config.ISP == "" || a.config.ISP == "cumt" {
+		return a.config.Account
+	}
+	return a.config.Account + "@" + a.config.ISP
+}
+
+func (a *srunAuthenticator) acID() string {
+	if a.config.ACID != "" {
+		return a.config.ACID
+	}
+	return defaultSrunACID
+}
+
+// endpoint 返回深澜 portal 下的接口地址
+func (a *srunAuthenticator) endpoint(path string, query url.Values) string {
+	query.Set("callback", "jsonp")
+	query.Set("_", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	return strings.TrimRight(a.config.PortalURL, "/") + path + "?" + query.Encode()
+}
+
+func (a *srunAuthenticator) Login(ctx context.Context) (*loginResult, error) {
+	client, sourceIP, err := portalClientFor(a.config)
+	if err != nil {
+		log.Printf("[%s] 无法确定源地址: %v\n", a.config.ID, err)
+		return nil, err
+	}
+	ip := ""
+	if sourceIP != nil {
+		ip = sourceIP.String()
+	}
+	username := a.username()
+
+	// 获取 challenge 作为本次登录的加密密钥
+	challenge, _, err := getJSONP(ctx, client, a.endpoint("/cgi-bin/get_challenge", url.Values{
+		"username": {username},
+		"ip":       {ip},
+	}))
+	if err != nil {
+		log.Printf("[%s] 获取 challenge 失败: %v\n", a.config.ID, err)
+		return nil, err
+	}
+	token := jsonField(challenge, "challenge")
+	if token == "" {
+		return nil, fmt.Errorf("深澜未返回 challenge: %s", jsonField(challenge, "error"))
+	}
+	if ip == "" {
+		ip = jsonField(challenge, "client_ip")
+	}
+
+	acID := a.acID()
+	info, err := srunInfo(username, a.config.Password, ip, acID, token)
+	if err != nil {
+		return nil, err
+	}
+	hmd5 := srunHMACMD5(a.config.Password, token)
+	chksum := srunChecksum(token, username, hmd5, acID, ip, info)
+
+	fields, raw, err := getJSONP(ctx, client, a.endpoint("/cgi-bin/srun_portal", url.Values{
+		"action":       {"login"},
+		"username":     {username},
+		"password":     {"{MD5}" + hmd5},
+		"ac_id":        {acID},
+		"ip":           {ip},
+		"chksum":       {chksum},
+		"info":         {info},
+		"n":            {srunN},
+		"type":         {srunType},
+		"os":           {"Linux"},
+		"name":         {"Linux"},
+		"double_stack": {"0"},
+	}))
+	if err != nil {
+		log.Printf("[%s] 深澜登录请求失败: %v\n", a.config.ID, err)
+		return nil, err
+	}
+	result := srunResult(fields, raw)
+	if result.OK() {
+		log.Printf("[%s] 深澜登录成功: %s\n", a.config.ID, result)
+	} else {
+		log.Printf("[%s] 深澜登录被拒绝: %s\n", a.config.ID, result)
+	}
+	return result, nil
+}
+
+func (a *srunAuthenticator) Logout(ctx context.Context) (*loginResult, error) {
+	client, sourceIP, err := portalClientFor(a.config)
+	if err != nil {
+		log.Printf("[%s] 无法确定源地址: %v\n", a.config.ID, err)
+		return nil, err
+	}
+	ip := ""
+	if sourceIP != nil {
+		ip = sourceIP.String()
+	} else if status, err := a.Status(ctx); err == nil {
+		ip = status.IP
+	}
+
+	fields, raw, err := getJSONP(ctx, client, a.endpoint("/cgi-bin/srun_portal", url.Values{
+		"action":   {"logout"},
+		"username": {a.username()},
+		"ip":       {ip},
+		"ac_id":    {a.acID()},
+	}))
+	if err != nil {
+		log.Printf("[%s] 深澜注销请求失败: %v\n", a.config.ID, err)
+		return nil, err
+	}
+	result := srunResult(fields, raw)
+
+	// 再次查询确认会话是否已结束
+	if status, err := a.Status(ctx); err == nil {
+		if status.Online && status.accountMatches(a.config.Account) {
+			log.Printf("[%s] 深澜仍显示账号 %s 在线，注销未生效\n", a.config.ID, a.config.Account)
+			result.Status = statusUnknown
+		} else {
+			log.Printf("[%s] 账号 %s 的会话已结束\n", a.config.ID, a.config.Account)
+			result.Status = statusSuccess
+		}
+	}
+	return result, nil
+}
+
+// Status 通过 rad_user_info 查询在线状态
+func (a *srunAuthenticator) Status(ctx context.Context) (*portalStatus, error) {
+	client, _, err := portalClientFor(a.config)
+	if err != nil {
+		return nil, err
+	}
+	fields, raw, err := getJSONP(ctx, client, a.endpoint("/cgi-bin/rad_user_info", url.Values{}))
+	if err != nil {
+		return nil, err
+	}
+	status := &portalStatus{
+		Online:  jsonField(fields, "error") == "ok",
+		Account: jsonField(fields, "user_name"),
+		IP:      jsonField(fields, "online_ip"),
+		MAC:     normalizeMAC(jsonField(fields, "user_mac")),
+		Raw:     raw,
+	}
+	if status.IP == "" {
+		status.IP = jsonField(fields, "client_ip")
+	}
+	if status.Online {
+		usage := &accountUsage{
+			Account:       status.Account,
+			OnlineIP:      status.IP,
+			OnlineMinutes: jsonNumber(fields, "sum_seconds") / 60,
+			UsedFlowMB:    jsonNumber(fields, "sum_bytes") / 1024 / 1024,
+			RemainFlowMB:  -1,
+			Balance:       jsonNumber(fields, "user_balance"),
+		}
+		if addTime := jsonNumber(fields, "add_time"); addTime > 0 {
+			usage.LoginTime = time.Unix(int64(addTime), 0).In(currentZone()).Format(statusTimeFormat)
+		}
+		if _, ok := fields["remain_bytes"]; ok {
+			usage.RemainFlowMB = jsonNumber(fields, "remain_bytes") / 1024 / 1024
+		}
+		status.Usage = usage
+	}
+	return status, nil
+}
+
+// Usage 返回配置账号的使用情况，账号不在线时返回错误
+func (a *srunAuthenticator) Usage(ctx context.Context) (*accountUsage, error) {
+	return usageFromStatus(ctx, a, a.config.Account)
+}
+
+// srunResult 将深澜的返回转换为统一的登录结果
+func srunResult(fields map[string]interface{}, raw string) *loginResult {
+	result := &loginResult{
+		Result:  jsonField(fields, "error"),
+		RetCode: jsonField(fields, "ecode"),
+		Msg:     jsonField(fields, "error_msg"),
+		Raw:     raw,
+	}
+	if result.Msg == "" {
+		result.Msg = jsonField(fields, "suc_msg")
+	}
+
+	msg := strings.ToLower(result.Msg)
+	switch {
+	case result.Result == "ok":
+		result.Status = statusSuccess
+	case containsAny(msg, "e2620", "already online"):
+		result.Status = statusAlreadyOnline
+	case containsAny(msg, "e2531", "e2553", "e2901", "user not found", "password is error", "密码错误"):
+		result.Status = statusBadCredentials
+	case containsAny(msg, "online_num", "online num", "在线数"):
+		result.Status = statusTooManySessions
+	case containsAny(msg, "e2616", "arrearage", "flux", "欠费", "流量"):
+		result.Status = statusQuotaExhausted
+	default:
+		result.Status = statusUnknown
+	}
+	return result
+}
+
+// getJSONP 发送 GET 请求并解析 JSONP 响应
+func getJSONP(ctx context.Context, client *http.Client, requestURL string) (map[string]interface{}, string, error) {
+	resp, err := httpGet(ctx, client, requestURL)
+	if err != nil {
+		return nil, "", classifyRequestError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("状态码: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", classifyRequestError(err)
+	}
+
+	raw := strings.TrimSpace(string(body))
+	payload := raw
+	if m := jsonpPattern.FindStringSubmatch(raw); m != nil {
+		payload = m[1]
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &fields); err != nil {
+		return nil, raw, fmt.Errorf("无法解析响应: %v", err)
+	}
+	return fields, raw, nil
+}
+
+// srunInfo 生成登录请求中的 info 参数：{SRBX1} + 自定义 base64(xencode(json, token))
+func srunInfo(username, password, ip, acID, token string) (string, error) {
+	// 字段顺序需与深澜前端 JSON.stringify 的结果一致
+	payload := struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		IP       string `json:"ip"`
+		ACID     string `json:"acid"`
+		EncVer   string `json:"enc_ver"`
+	}{username, password, ip, acID, srunEncVer}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(payload); err != nil {
+		return "", err
+	}
+	data := strings.TrimSuffix(buf.String(), "\n")
+	return "{SRBX1}" + srunBase64.EncodeToString(srunXEncode(data, token)), nil
+}
+
+// srunHMACMD5 以 token 为密钥计算密码的 HMAC-MD5
+func srunHMACMD5(password, token string) string {
+	mac := hmac.New(md5.New, []byte(token))
+	mac.Write([]byte(password))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// srunChecksum 计算登录请求的 SHA1 校验和
+func srunChecksum(token, username, hmd5, acID, ip, info string) string {
+	var b strings.Builder
+	for _, part := range []string{username, hmd5, acID, ip, srunN, srunType, info} {
+		b.WriteString(token)
+		b.WriteString(part)
+	}
+	sum := sha1.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// srunXEncode 实现深澜前端的 xEncode（XXTEA 变体）
+func srunXEncode(msg, key string) []byte {
+	if msg == "" {
+		return nil
+	}
+	v := srunToWords([]byte(msg), true)
+	k := srunToWords([]byte(key), false)
+	for len(k) < 4 {
+		k = append(k, 0)
+	}
+
+	n := uint32(len(v) - 1)
+	z := v[n]
+	var y, d uint32
+	const delta = 0x9E3779B9
+	for q := 6 + 52/(n+1); q > 0; q-- {
+		d += delta
+		e := (d >> 2) & 3
+		var p uint32
+		for p = 0; p < n; p++ {
+			y = v[p+1]
+			m := (z>>5 ^ y<<2) + ((y>>3 ^ z<<4) ^ (d ^ y)) + (k[(p&3)^e] ^ z)
+			v[p] += m
+			z = v[p]
+		}
+		y = v[0]
+		m := (z>>5 ^ y<<2) + ((y>>3 ^ z<<4) ^ (d ^ y)) + (k[(p&3)^e] ^ z)
+		v[n] += m
+		z = v[n]
+	}
+	return srunFromWords(v)
+}
+
+// srunToWords 按小端序将字节转换为 32 位整数数组，appendLen 时在末尾追加原始长度
+func srunToWords(data []byte, appendLen bool) []uint32 {
+	words := make([]uint32, (len(data)+3)/4)
+	for i, b := range data {
+		words[i>>2] |= uint32(b) << (8 * uint(i&3))
+	}
+	if appendLen {
+		words = append(words, uint32(len(data)))
+	}
+	return words
+}
+
+// srunFromWords 将 32 位整数数组按小端序还原为字节
+func srunFromWords(words []uint32) []byte {
+	data := make([]byte, 0, len(words)*4)
+	for _, w := range words {
+		data = append(data, byte(w), byte(w>>8), byte(w>>16), byte(w>>24))
+	}
+	return data
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"cumtnet/fakeportal"
+)
+
+// 以下向量由深澜前端 JS（xEncode、jquery.base64 自定义字母表、md5 HMAC、sha1）计算得到
+var srunVectors = []struct {
+	username, password, ip, acID, token string
+	info, hmd5, chksum                  string
+}{
+	{
+		"08123456", "secret", "10.2.3.4", "1",
+		"3f6a1c0e9b2d4f8a7c5e1b3d9f0a2c4e6b8d0f1a3c5e7b9d1f3a5c7e9b0d2f4a",
+		"{SRBX1}er7yAx0aXXd3O14XLuLXmLuEN3yTBXf+mJs8aWGJI/vDOYh5+mKEOZD/VapW+2Qn+spxCwRz8zvuSsM6BQWCoQSqEvWCgOiynkYt4+tFoDcZZTE9QVgRU1jPdb39uxGo",
+		"303431622f592fb2e84f2c930225c39d",
+		"4aac3bf42099dd84a0e32d65201e27e781ec8b8d",
+	},
+	{
+		"08123456@cmcc", "p@ss:w&rd#%+", "192.168.100.23", "12", "0123456789abcdef",
+		"{SRBX1}j+oqLefxKzhhFIUCsoRq0N5EjzcA1PT/+w2XgVFi+Fr3YWe/k/rxVp/Iy15qJvqXOXZTUMBLjEe851CN4Mmb+wyk3IZst5lwtA9Y04J4WKy7vKXI0ZT7RBeTkT8N60XWy9hbJp7I1J0h972+icxdPOEwNL4=",
+		"a3d1f07636ec7f42b8bdd1678a9cf339",
+		"4cdabd3caa53369b3d14dc868c91f7c1c6d5d11d",
+	},
+	{
+		"a", "b", "1.1.1.1", "1", "k",
+		"{SRBX1}QirwZpFrt2W/EQ1AoaYmWQeh9PPU4AcvdWcfATCWmhqH8iHCb205zKfANmYHebJWF9DMAN8LTOCs1cWnOXIeUV1MaGSU36XFPL1hl3pJ0LoMnOY8",
+		"681c83990e2f2b2a4e716d5690510cdc",
+		"fdfad62cb6b7a69a469c955c00270a63d095e2fc",
+	},
+}
+
+func TestSrunVectors(t *testing.T) {
+	for _, v := range srunVectors {
+		info, err := srunInfo(v.username, v.password, v.ip, v.acID, v.token)
+		if err != nil {
+			t.Fatalf("srunInfo(%s): %v", v.username, err)
+		}
+		if info != v.info {
+			t.Errorf("srunInfo(%s) =\n%s\nwant\n%s", v.username, info, v.info)
+		}
+		if hmd5 := srunHMACMD5(v.password, v.token); hmd5 != v.hmd5 {
+			t.Errorf("srunHMACMD5(%s) = %s, want %s", v.username, hmd5, v.hmd5)
+		}
+		if chksum := srunChecksum(v.token, v.username, v.hmd5, v.acID, v.ip, v.info); chksum != v.chksum {
+			t.Errorf("srunChecksum(%s) = %s, want %s", v.username, chksum, v.chksum)
+		}
+	}
+}
+
+func TestSrunLoginLogout(t *testing.T) {
+	portal := fakeportal.New()
+	portal.AddAccount(fakeportal.Account{ID: "08123456", Password: "p@ss:w&rd#%+", ISP: "cmcc"})
+	server := httptest.NewServer(portal)
+	t.Cleanup(server.Close)
+
+	config := loginConfig{
+		Config:     Config{ID: "srun"},
+		PortalURL:  server.URL,
+		PortalType: "srun",
+		Account:    "08123456",
+		Password:   "p@ss:w&rd#%+",
+		ISP:        "cmcc",
+		SourceIP:   "127.0.0.1",
+	}
+	auth := newSrunAuthenticator(config)
+
+	result, err := auth.Login(context.Background())
+	if err != nil || result.Status != statusSuccess {
+		t.Fatalf("Login() = %v, %v; want success", result, err)
+	}
+	status, err := auth.Status(context.Background())
+	if err != nil || !status.Online || !status.accountMatches("08123456") || status.IP != "127.0.0.1" {
+		t.Fatalf("Status() = %v, %v; want online as 08123456", status, err)
+	}
+	if result, err := auth.Login(context.Background()); err != nil || result.Status != statusAlreadyOnline {
+		t.Errorf("second Login() = %v, %v; want already_online", result, err)
+	}
+
+	result, err = auth.Logout(context.Background())
+	if err != nil || result.Status != statusSuccess {
+		t.Fatalf("Logout() = %v, %v; want success", result, err)
+	}
+	if status, err := auth.Status(context.Background()); err != nil || status.Online {
+		t.Errorf("Status() after logout = %v, %v; want offline", status, err)
+	}
+
+	config.Password = "wrong"
+	if result, err := newSrunAuthenticator(config).Login(context.Background()); err != nil || result.Status != statusBadCredentials {
+		t.Errorf("Login() with wrong password = %v, %v; want bad_credentials", result, err)
+	}
+}
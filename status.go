@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StatusFilePath 运行状态文件，供 cumtnet status 和 luci 读取
+// 文件中保存完整账号，仅 root 可读，账号在输出时脱敏
+const StatusFilePath = "/tmp/cumt-net.status.json"
+
+// statusFilePath 实际写入的状态文件，测试中指向临时目录
+var statusFilePath = StatusFilePath
+
+// statusTimeFormat 状态文件中的时间格式
+const statusTimeFormat = "2006-01-02 15:04:05"
+
+// accountUsage 是账号的使用情况快照
+type accountUsage struct {
+	Account       string  `json:"account"`
+	OnlineIP      string  `json:"online_ip"`
+	LoginTime     string  `json:"login_time,omitempty"`
+	OnlineMinutes float64 `json:"online_minutes"`
+	UsedFlowMB    float64 `json:"used_flow_mb"`
+	RemainFlowMB  float64 `json:"remain_flow_mb"` // 未知时为 -1
+	Balance       float64 `json:"balance"`        // 余额（元）
+	UpdatedAt     string  `json:"updated_at"`
+}
+
+// usageReporter 由能查询账号使用情况的 portal 驱动实现
+type usageReporter interface {
+	Usage(ctx context.Context) (*accountUsage, error)
+}
+
+// ruleState 是一条规则的运行状态
+type ruleState struct {
+	ID         string        `json:"id"`
+	Kind       string        `json:"kind"` // login 或 passwall
+	NextRun    string        `json:"next_run,omitempty"`
+	LastRun    string        `json:"last_run,omitempty"`
+	LastResult string        `json:"last_result,omitempty"`
+	LastError  string        `json:"last_error,omitempty"`
+	LastKicked string        `json:"last_kicked,omitempty"` // 最近一次为登录而下线的会话
+	Usage      *accountUsage `json:"usage,omitempty"`
+}
+
+// 按 ruleKey 保存的规则状态
+var (
+	ruleStatesLock sync.Mutex
+	ruleStates     = make(map[string]*ruleState)
+)
+
+// ruleKey 返回规则在状态和任务中的唯一标识，login 和 passwall 规则可以同名
+func ruleKey(kind, id string) string {
+	return kind + ":" + id
+}
+
+// updateRuleState 修改规则状态并写入状态文件
+func updateRuleState(id, kind string, update func(state *ruleState)) {
+	ruleStatesLock.Lock()
+	defer ruleStatesLock.Unlock()
+
+	key := ruleKey(kind, id)
+	state, ok := ruleStates[key]
+	if !ok {
+		state = &ruleState{ID: id, Kind: kind}
+		ruleStates[key] = state
+	}
+	update(state)
+	saveStatusFile()
+}
+
+// recordNextRun 记录规则的下次执行时间
+func recordNextRun(id, kind string, next time.Time) {
+	updateRuleState(id, kind, func(state *ruleState) {
+		state.NextRun = next.Format(statusTimeFormat)
+	})
+}
+
+// recordLoginResult 记录 login 规则的执行结果，已知错误附带中英文说明
+func recordLoginResult(id string, result *loginResult, err error) {
+	updateRuleState(id, "login", func(state *ruleState) {
+		state.LastRun = localNow().Format(statusTimeFormat)
+		state.LastError = ""
+		switch {
+		case err != nil:
+			state.LastResult = "error"
+			state.LastError = redact(err.Error())
+		case result == nil:
+			state.LastResult = "skipped"
+		default:
+			state.LastResult = result.Status.String()
+			if result.Err != nil {
+				state.LastError = fmt.Sprintf("%s / %s", result.Err.Chinese, result.Err.English)
+			} else if !result.OK() {
+				state.LastError = result.Msg
+			}
+		}
+	})
+}
+
+// recordPasswallRun 记录 passwall 规则的执行时间
+func recordPasswallRun(id string) {
+	updateRuleState(id, "passwall", func(state *ruleState) {
+		state.LastRun = localNow().Format(statusTimeFormat)
+		state.LastResult = "done"
+	})
+}
+
+// refreshUsage 查询 login 规则当前账号的使用情况并保存快照
+func refreshUsage(ctx context.Context, config loginConfig) {
+	active, _ := config.activeAccount()
+	auth, err := newAuthenticator(config.withAccount(active))
+	if err != nil {
+		return
+	}
+	reporter, ok := auth.(usageReporter)
+	if !ok {
+		return
+	}
+	usage, err := reporter.Usage(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		log.Printf("[%s] 获取账号使用情况失败: %v\n", config.ID, err)
+		return
+	}
+	usage.UpdatedAt = localNow().Format(statusTimeFormat)
+	updateRuleState(config.ID, "login", func(state *ruleState) {
+		state.Usage = usage
+	})
+}
+
+// pruneRuleStates 删除已不存在的规则的状态，keys 为现有规则的 ruleKey
+func pruneRuleStates(keys map[string]bool) {
+	ruleStatesLock.Lock()
+	defer ruleStatesLock.Unlock()
+	for key := range ruleStates {
+		if !keys[key] {
+			delete(ruleStates, key)
+		}
+	}
+	saveStatusFile()
+}
+
+// saveStatusFile 将所有规则状态写入状态文件，调用方需持有 ruleStatesLock
+func saveStatusFile() {
+	states := make([]*ruleState, 0, len(ruleStates))
+	for _, state := range ruleStates {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].ID != states[j].ID {
+			return states[i].ID < states[j].ID
+		}
+		return states[i].Kind < states[j].Kind
+	})
+
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		log.Printf("序列化运行状态失败: %v", err)
+		return
+	}
+	// 先写临时文件再重命名，避免读取到写了一半的文件
+	tmp := statusFilePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		log.Printf("写入运行状态失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, statusFilePath); err != nil {
+		log.Printf("写入运行状态失败: %v", err)
+	}
+}
+
+// jsonNumber 将 JSON 字段解析为数值，字段缺失或无效时为 0
+func jsonNumber(fields map[string]interface{}, key string) float64 {
+	n, err := strconv.ParseFloat(jsonField(fields, key), 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// runStatus 实现 cumtnet status 子命令，打印各规则的调度信息和账号使用情况
+func runStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	file := fs.String("file", StatusFilePath, "运行状态文件路径")
+	asJSON := fs.Bool("json", false, "以 JSON 格式输出")
+	fs.BoolVar(&showSecrets, "show-secrets", false, "显示完整账号")
+	fs.Parse(args)
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无法读取运行状态，cumtnet 是否正在运行？%v\n", err)
+		os.Exit(1)
+	}
+	var states []*ruleState
+	if err := json.Unmarshal(data, &states); err != nil {
+		fmt.Fprintf(os.Stderr, "无法解析运行状态: %v\n", err)
+		os.Exit(1)
+	}
+	if *asJSON {
+		printStatusJSON(states)
+		return
+	}
+	printStatusText(states)
+}
+
+// printStatusText 以文本格式打印运行状态，账号除非 -show-secrets 否则脱敏
+func printStatusText(states []*ruleState) {
+	for _, state := range states {
+		fmt.Printf("[%s] %s\n", state.ID, state.Kind)
+		fmt.Printf("  下次执行: %s\n", state.NextRun)
+		fmt.Printf("  上次执行: %s %s\n", state.LastRun, state.LastResult)
+		if state.LastError != "" {
+			fmt.Printf("  错误说明: %s\n", state.LastError)
+		}
+		if state.LastKicked != "" {
+			fmt.Printf("  下线会话: %s\n", state.LastKicked)
+		}
+		if u := state.Usage; u != nil {
+			fmt.Printf("  在线账号: %s (%s)\n", maskAccount(u.Account), u.OnlineIP)
+			if u.LoginTime != "" {
+				fmt.Printf("  登录时间: %s\n", u.LoginTime)
+			}
+			fmt.Printf("  在线时长: %.0f 分钟\n", u.OnlineMinutes)
+			fmt.Printf("  已用流量: %.2f MB\n", u.UsedFlowMB)
+			if u.RemainFlowMB >= 0 {
+				fmt.Printf("  剩余流量: %.2f MB\n", u.RemainFlowMB)
+			}
+			fmt.Printf("  账户余额: %.2f 元\n", u.Balance)
+			fmt.Printf("  更新时间: %s\n", u.UpdatedAt)
+		}
+		fmt.Println("----------------------------------------")
+	}
+}
+
+// printStatusJSON 以 JSON 格式打印运行状态，账号除非 -show-secrets 否则脱敏
+func printStatusJSON(states []*ruleState) {
+	for _, state := range states {
+		if state.Usage != nil {
+			state.Usage.Account = maskAccount(state.Usage.Account)
+		}
+	}
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "序列化运行状态失败: %v\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(data)
+	fmt.Println()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"cumtnet/fakeportal"
+)
+
+func TestStatusFileKeepsAccount(t *testing.T) {
+	portal, baseURL := newFakePortal(t, fakeportal.Account{ID: "08200001", Password: "pw"})
+	portal.AddSession("08200001", "127.0.0.1", "aabbccddeeff")
+
+	config := fakeLoginConfig(baseURL, "08200001", "pw")
+	config.ID = "usage"
+	refreshUsage(context.Background(), config)
+	t.Cleanup(func() { pruneRuleStates(map[string]bool{}) })
+
+	// 状态文件保存完整账号，只允许 root 读取
+	info, err := os.Stat(statusFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("status file mode = %v, want 0600", perm)
+	}
+	data, err := os.ReadFile(statusFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states []*ruleState
+	if err := json.Unmarshal(data, &states); err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range states {
+		if state.ID == config.ID {
+			if state.Usage == nil || state.Usage.Account != "08200001" {
+				t.Errorf("usage = %+v, want account 08200001", state.Usage)
+			}
+			return
+		}
+	}
+	t.Errorf("status file has no state for %s:\n%s", config.ID, data)
+}
+
+func TestPrintStatusMasksAccount(t *testing.T) {
+	newStates := func() []*ruleState {
+		return []*ruleState{{ID: "work", Kind: "login", Usage: &accountUsage{Account: "08200001", OnlineIP: "10.0.0.1"}}}
+	}
+	printers := map[string]func([]*ruleState){
+		"status":       printStatusText,
+		"status -json": printStatusJSON,
+	}
+	for name, print := range printers {
+		out := captureStdout(t, func() { print(newStates()) })
+		if strings.Contains(out, "08200001") || !strings.Contains(out, maskAccount("08200001")) {
+			t.Errorf("%s printed:\n%s\nwant the account masked", name, out)
+		}
+	}
+
+	showSecrets = true
+	t.Cleanup(func() { showSecrets = false })
+	for name, print := range printers {
+		if out := captureStdout(t, func() { print(newStates()) }); !strings.Contains(out, "08200001") {
+			t.Errorf("%s -show-secrets printed:\n%s\nwant the full account", name, out)
+		}
+	}
+}
+
+// captureStdout 返回 f 执行期间写入标准输出的内容
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	f()
+	os.Stdout = stdout
+	w.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
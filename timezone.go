@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"cumtnet/scheduler"
+)
+
+// defaultZone 未配置时区且无法读取系统时区时使用的东八区
+var defaultZone = time.FixedZone("CST", 8*3600)
+
+// currentZoneValue 保存当前使用的时区，用于调度、日志和状态文件，不修改 time.Local
+var currentZoneValue atomic.Pointer[time.Location]
+
+// currentZone 返回当前使用的时区
+func currentZone() *time.Location {
+	if loc := currentZoneValue.Load(); loc != nil {
+		return loc
+	}
+	return defaultZone
+}
+
+// localNow 返回当前时区的当前时间
+func localNow() time.Time {
+	return time.Now().In(currentZone())
+}
+
+// localClock 是使用当前时区的系统时钟，供调度器使用
+type localClock struct{}
+
+func (localClock) Now() time.Time { return localNow() }
+
+func (localClock) NewTimer(d time.Duration) scheduler.Timer {
+	return scheduler.RealClock().NewTimer(d)
+}
+
+// configureTimezone 依次使用全局配置的 timezone、OpenWrt 的 system.@system[0].zonename、
+// system.@system[0].timezone 和东八区
+func configureTimezone(global globalConfig) {
+	loc, source := resolveTimezone(global.Timezone, uciGet)
+	currentZoneValue.Store(loc)
+	log.Printf("使用时区: %s（%s）\n", loc, source)
+}
+
+// resolveTimezone 按 configureTimezone 的顺序选出时区，lookup 读取 uci 配置项
+// IANA 时区名需要 /usr/share/zoneinfo（OpenWrt 的 zoneinfo-* 软件包），没有时由 timezone 中的
+// POSIX 字符串（如 CST-8）得到固定偏移，因此不内置时区数据；需要时可使用 -tags timetzdata 编译
+func resolveTimezone(configured string, lookup func(key string) (string, error)) (*time.Location, string) {
+	if configured != "" {
+		if loc, err := parseTimezone(configured); err != nil {
+			log.Printf("全局配置 timezone 无效，忽略: %v\n", err)
+		} else {
+			return loc, "配置"
+		}
+	}
+	for _, key := range []string{"system.@system[0].zonename", "system.@system[0].timezone"} {
+		name, err := lookup(key)
+		if err != nil || name == "" {
+			continue
+		}
+		if loc, err := parseTimezone(name); err != nil {
+			log.Printf("系统时区 %s 无效，忽略: %v\n", name, err)
+		} else {
+			return loc, "系统"
+		}
+	}
+	return defaultZone, "默认"
+}
+
+// utcOffsetPattern 匹配 UTC+8、GMT-5:30 形式的固定偏移，符号与通常的写法一致
+var utcOffsetPattern = regexp.MustCompile(`^(?:UTC|GMT)([+-])(\d{1,2})(?::(\d{2}))?$`)
+
+// posixTZPattern 匹配不含夏令时规则的 POSIX TZ 字符串，如 CST-8、<+0530>-5:30，
+// 其中的偏移为本地时间到 UTC 的差值，符号与通常的写法相反
+var posixTZPattern = regexp.MustCompile(`^([A-Za-z]{3,}|<[+-]?[A-Za-z0-9]+>)([+-]?)(\d{1,2})(?::(\d{2}))?$`)
+
+// parseTimezone 解析 IANA 时区名（如 Asia/Shanghai）、UTC+8 形式的固定偏移或 POSIX TZ 字符串
+func parseTimezone(name string) (*time.Location, error) {
+	// OpenWrt 的 zonename 使用空格代替下划线，如 America/New York
+	name = strings.ReplaceAll(strings.TrimSpace(name), " ", "_")
+	if name == "" {
+		return nil, fmt.Errorf("时区为空")
+	}
+	if m := utcOffsetPattern.FindStringSubmatch(strings.ToUpper(name)); m != nil {
+		offset, err := zoneOffset(m[2], m[3])
+		if err != nil {
+			return nil, fmt.Errorf("无效的时区偏移: %s", name)
+		}
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(strings.ToUpper(name), offset), nil
+	}
+	if m := posixTZPattern.FindStringSubmatch(name); m != nil {
+		// UTC8 按 POSIX 是西八区，多半是写错了符号的 UTC+8，不猜测
+		if strings.EqualFold(m[1], "UTC") || strings.EqualFold(m[1], "GMT") {
+			return nil, fmt.Errorf("时区 %s 有歧义，请使用 UTC+8 或 UTC-8 的写法", name)
+		}
+		offset, err := zoneOffset(m[3], m[4])
+		if err != nil {
+			return nil, fmt.Errorf("无效的时区偏移: %s", name)
+		}
+		if m[2] != "-" {
+			offset = -offset
+		}
+		return time.FixedZone(strings.Trim(m[1], "<>"), offset), nil
+	}
+	return time.LoadLocation(name)
+}
+
+// zoneOffset 将小时和分钟转换为秒数，偏移不能超过 14 小时
+func zoneOffset(hours, minutes string) (int, error) {
+	h, _ := strconv.Atoi(hours)
+	m := 0
+	if minutes != "" {
+		m, _ = strconv.Atoi(minutes)
+	}
+	if h > 14 || m >= 60 || (h == 14 && m > 0) {
+		return 0, fmt.Errorf("偏移超出范围")
+	}
+	return h*3600 + m*60, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata" // 测试环境不一定有 /usr/share/zoneinfo
+)
+
+func TestParseTimezone(t *testing.T) {
+	winter := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	summer := time.Date(2026, 7, 15, 12, 0, 0, 0, time.UTC)
+	const hour = 3600
+	tests := []struct {
+		name         string
+		winter       int // 1 月的 UTC 偏移（秒）
+		summer       int // 7 月的 UTC 偏移（秒）
+		wantErr      bool
+		wantZoneName string // 非空时检查时区名称
+	}{
+		{name: "UTC+8", winter: 8 * hour, summer: 8 * hour, wantZoneName: "UTC+8"},
+		{name: "utc+08", winter: 8 * hour, summer: 8 * hour},
+		{name: "GMT-5:30", winter: -5*hour - 1800, summer: -5*hour - 1800},
+		{name: "UTC+14", winter: 14 * hour, summer: 14 * hour},
+		{name: "UTC-0", winter: 0, summer: 0},
+		{name: " UTC+8 ", winter: 8 * hour, summer: 8 * hour},
+		// POSIX TZ 的偏移符号与通常的写法相反
+		{name: "CST-8", winter: 8 * hour, summer: 8 * hour, wantZoneName: "CST"},
+		{name: "EST5", winter: -5 * hour, summer: -5 * hour},
+		{name: "JST-9", winter: 9 * hour, summer: 9 * hour},
+		{name: "IST-5:30", winter: 5*hour + 1800, summer: 5*hour + 1800},
+		{name: "<+0545>-5:45", winter: 5*hour + 2700, summer: 5*hour + 2700, wantZoneName: "+0545"},
+		{name: "<-03>3", winter: -3 * hour, summer: -3 * hour},
+		// IANA 时区名，包括 OpenWrt zonename 中用空格代替的下划线
+		{name: "Asia/Shanghai", winter: 8 * hour, summer: 8 * hour},
+		{name: "UTC", winter: 0, summer: 0},
+		{name: "America/New York", winter: -5 * hour, summer: -4 * hour},
+		{name: "America/New_York", winter: -5 * hour, summer: -4 * hour},
+		{name: "Asia/Ho Chi Minh", winter: 7 * hour, summer: 7 * hour},
+		{name: "America/Argentina/Buenos Aires", winter: -3 * hour, summer: -3 * hour},
+		{name: "EST5EDT", winter: -5 * hour, summer: -4 * hour},
+		// 无效的时区
+		{name: "", wantErr: true},
+		{name: "   ", wantErr: true},
+		{name: "UTC+15", wantErr: true},
+		{name: "UTC+14:30", wantErr: true},
+		{name: "GMT+5:60", wantErr: true},
+		{name: "CST-15", wantErr: true},
+		{name: "UTC8", wantErr: true},
+		{name: "Asia/Nowhere", wantErr: true},
+		{name: "EST5EDT,M3.2.0,M11.1.0", wantErr: true},
+		{name: "+8", wantErr: true},
+	}
+	for _, tt := range tests {
+		loc, err := parseTimezone(tt.name)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseTimezone(%q) = %s, want error", tt.name, loc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTimezone(%q): %v", tt.name, err)
+			continue
+		}
+		zone, winterOffset := winter.In(loc).Zone()
+		_, summerOffset := summer.In(loc).Zone()
+		if winterOffset != tt.winter || summerOffset != tt.summer {
+			t.Errorf("parseTimezone(%q) offsets = %d/%d, want %d/%d", tt.name, winterOffset, summerOffset, tt.winter, tt.summer)
+		}
+		if tt.wantZoneName != "" && zone != tt.wantZoneName {
+			t.Errorf("parseTimezone(%q) zone name = %q, want %q", tt.name, zone, tt.wantZoneName)
+		}
+	}
+}
+
+func TestResolveTimezone(t *testing.T) {
+	uci := func(values map[string]string) func(key string) (string, error) {
+		return func(key string) (string, error) {
+			if v, ok := values[key]; ok {
+				return v, nil
+			}
+			return "", errors.New("uci: Entry not found")
+		}
+	}
+	openwrt := map[string]string{
+		"system.@system[0].zonename": "Asia/Tokyo",
+		"system.@system[0].timezone": "JST-9",
+	}
+	tests := []struct {
+		name       string
+		configured string
+		system     map[string]string
+		wantZone   string
+		wantSource string
+	}{
+		{"config wins", "UTC+3", openwrt, "UTC+3", "配置"},
+		{"invalid config falls back to zonename", "Mars/Olympus", openwrt, "Asia/Tokyo", "系统"},
+		{"zonename", "", openwrt, "Asia/Tokyo", "系统"},
+		{"zonename with spaces", "", map[string]string{"system.@system[0].zonename": "America/New York"}, "America/New_York", "系统"},
+		// 没有 zoneinfo 时 zonename 无法加载，使用 POSIX 的 timezone
+		{"timezone when zonename fails", "", map[string]string{
+			"system.@system[0].zonename": "Asia/Nowhere",
+			"system.@system[0].timezone": "CST-8",
+		}, "CST", "系统"},
+		{"timezone only", "", map[string]string{"system.@system[0].timezone": "<+07>-7"}, "+07", "系统"},
+		{"empty zonename", "", map[string]string{"system.@system[0].zonename": ""}, "CST", "默认"},
+		{"no uci", "", nil, "CST", "默认"},
+		{"nothing valid", "bogus", map[string]string{"system.@system[0].timezone": "EST5EDT,M3.2.0,M11.1.0"}, "CST", "默认"},
+	}
+	now := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		loc, source := resolveTimezone(tt.configured, uci(tt.system))
+		if source != tt.wantSource {
+			t.Errorf("%s: source = %s, want %s", tt.name, source, tt.wantSource)
+		}
+		// 固定偏移的时区以名称比较，IANA 时区以 String 比较
+		zone, _ := now.In(loc).Zone()
+		if loc.String() != tt.wantZone && zone != tt.wantZone {
+			t.Errorf("%s: zone = %s (%s), want %s", tt.name, loc, zone, tt.wantZone)
+		}
+	}
+
+	// 默认时区为东八区
+	if loc, _ := resolveTimezone("", uci(nil)); loc != defaultZone {
+		t.Errorf("default zone = %s, want %s", loc, defaultZone)
+	}
+	if _, offset := now.In(defaultZone).Zone(); offset != 8*3600 {
+		t.Errorf("default zone offset = %d, want %d", offset, 8*3600)
+	}
+}